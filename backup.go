@@ -0,0 +1,432 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thimc/totp/otp"
+	"golang.org/x/crypto/scrypt"
+)
+
+// entry is an entry of the backup of an authenticator app.
+type entry struct {
+	kind      string // totp, hotp or steam
+	issuer    string
+	account   string
+	secret    string // base32 encoded
+	algorithm string
+	digits    int
+	period    int
+	counter   uint64
+}
+
+// provider converts e, the parameters that are not set default to the
+// ones of RFC6238. Invalid parameters are reported as errors.
+func (e entry) provider() (provider, error) {
+	p := provider{issuer: e.issuer, secret: e.secret, name: e.account}
+	if e.issuer != "" {
+		p.name = e.issuer + ":" + e.account
+	}
+	switch strings.ToLower(e.kind) {
+	case "", "totp":
+	case "hotp":
+		p.hotp = true
+		p.counter = e.counter
+	case "steam":
+		p.encoder, p.config.Encoder = "steam", otp.Steam
+	default:
+		return p, fmt.Errorf("%q: unsupported type %q", p.name, e.kind)
+	}
+	// The parameters are checked like the ones of the secrets file,
+	// so that the imported entries can be read back.
+	params := []struct {
+		key, value string
+		set        bool
+	}{
+		{"algorithm", e.algorithm, e.algorithm != ""},
+		{"digits", strconv.Itoa(e.digits), e.digits != 0},
+		{"period", strconv.Itoa(e.period), e.period != 0},
+	}
+	for _, param := range params {
+		if !param.set {
+			continue
+		}
+		if err := p.set(param.key, param.value); err != nil {
+			return p, fmt.Errorf("%q: %w", p.name, err)
+		}
+	}
+	if err := p.decode(); err != nil {
+		return p, fmt.Errorf("%q: %w", p.name, err)
+	}
+	return p, nil
+}
+
+// isBackup reports whether data is the JSON backup of an authenticator
+// app.
+func isBackup(data []byte) bool {
+	data = bytes.TrimSpace(data)
+	return len(data) > 0 && (data[0] == '{' || data[0] == '[')
+}
+
+// readBackup returns the entries of the backup data, which may have
+// been made by Aegis, andOTP, 2FAS or FreeOTP+. Entries that can't be
+// converted are reported and left out.
+func readBackup(data []byte) ([]provider, error) {
+	var (
+		entries []entry
+		err     error
+	)
+	if bytes.TrimSpace(data)[0] == '[' {
+		entries, err = readAndOTP(data)
+	} else {
+		var keys map[string]json.RawMessage
+		if err := json.Unmarshal(data, &keys); err != nil {
+			return nil, err
+		}
+		switch {
+		case keys["db"] != nil && keys["header"] != nil:
+			entries, err = readAegis(data)
+		case keys["services"] != nil:
+			entries, err = readTwoFAS(data)
+		case keys["tokens"] != nil:
+			entries, err = readFreeOTP(data)
+		default:
+			return nil, fmt.Errorf("unknown backup format")
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	var providers []provider
+	for _, e := range entries {
+		p, err := e.provider()
+		if err != nil {
+			warnImport(err)
+			continue
+		}
+		providers = append(providers, p)
+	}
+	return providers, nil
+}
+
+// aegisEntry is an entry of the database of an Aegis vault.
+type aegisEntry struct {
+	Type   string `json:"type"`
+	Name   string `json:"name"`
+	Issuer string `json:"issuer"`
+	Info   struct {
+		Secret  string `json:"secret"`
+		Algo    string `json:"algo"`
+		Digits  int    `json:"digits"`
+		Period  int    `json:"period"`
+		Counter uint64 `json:"counter"`
+	} `json:"info"`
+}
+
+// aegisParams are the parameters of AES-GCM used by Aegis vaults.
+type aegisParams struct {
+	Nonce string `json:"nonce"`
+	Tag   string `json:"tag"`
+}
+
+// open decrypts ciphertext with key.
+func (a aegisParams) open(key, ciphertext []byte) ([]byte, error) {
+	nonce, err := hex.DecodeString(a.Nonce)
+	if err != nil {
+		return nil, err
+	}
+	tag, err := hex.DecodeString(a.Tag)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := cipher.NewGCMWithNonceSize(block, len(nonce))
+	if err != nil {
+		return nil, err
+	}
+	return aead.Open(nil, nonce, append(bytes.Clone(ciphertext), tag...), nil)
+}
+
+// readAegis reads the entries of an Aegis vault. The database of an
+// encrypted vault is sealed with a master key, which is in turn sealed
+// in a slot with a key derived from the passphrase using scrypt.
+func readAegis(data []byte) ([]entry, error) {
+	var vault struct {
+		Header struct {
+			Slots []struct {
+				Type      int         `json:"type"`
+				Key       string      `json:"key"`
+				KeyParams aegisParams `json:"key_params"`
+				N         int         `json:"n"`
+				R         int         `json:"r"`
+				P         int         `json:"p"`
+				Salt      string      `json:"salt"`
+			} `json:"slots"`
+			Params *aegisParams `json:"params"`
+		} `json:"header"`
+		DB json.RawMessage `json:"db"`
+	}
+	if err := json.Unmarshal(data, &vault); err != nil {
+		return nil, err
+	}
+	db := []byte(vault.DB)
+	if vault.Header.Params != nil {
+		var sealed string
+		if err := json.Unmarshal(vault.DB, &sealed); err != nil {
+			return nil, err
+		}
+		ciphertext, err := base64.StdEncoding.DecodeString(sealed)
+		if err != nil {
+			return nil, fmt.Errorf("db: %w", err)
+		}
+		passphrase, err := readPassphrase("Aegis passphrase: ")
+		if err != nil {
+			return nil, err
+		}
+		var master []byte
+		for _, s := range vault.Header.Slots {
+			// Only password slots can be used, the others are
+			// tied to the device.
+			if s.Type != 1 {
+				continue
+			}
+			salt, err := hex.DecodeString(s.Salt)
+			if err != nil {
+				return nil, err
+			}
+			key, err := scrypt.Key(passphrase, salt, s.N, s.R, s.P, 32)
+			if err != nil {
+				return nil, err
+			}
+			sealedKey, err := hex.DecodeString(s.Key)
+			if err != nil {
+				return nil, err
+			}
+			if master, err = s.KeyParams.open(key, sealedKey); err == nil {
+				break
+			}
+		}
+		if master == nil {
+			return nil, fmt.Errorf("wrong passphrase")
+		}
+		if db, err = vault.Header.Params.open(master, ciphertext); err != nil {
+			return nil, fmt.Errorf("db: %w", err)
+		}
+	}
+	var contents struct {
+		Entries []aegisEntry `json:"entries"`
+	}
+	if err := json.Unmarshal(db, &contents); err != nil {
+		return nil, err
+	}
+	var entries []entry
+	for _, e := range contents.Entries {
+		entries = append(entries, entry{
+			kind:      e.Type,
+			issuer:    e.Issuer,
+			account:   e.Name,
+			secret:    e.Info.Secret,
+			algorithm: e.Info.Algo,
+			digits:    e.Info.Digits,
+			period:    e.Info.Period,
+			counter:   e.Info.Counter,
+		})
+	}
+	return entries, nil
+}
+
+// writeAegis writes the entries to w as an unencrypted Aegis vault.
+func writeAegis(w io.Writer, entries []*provider) error {
+	type info struct {
+		Secret  string  `json:"secret"`
+		Algo    string  `json:"algo"`
+		Digits  int     `json:"digits"`
+		Period  int     `json:"period,omitempty"`
+		Counter *uint64 `json:"counter,omitempty"`
+	}
+	type aegisExport struct {
+		Type   string  `json:"type"`
+		UUID   string  `json:"uuid"`
+		Name   string  `json:"name"`
+		Issuer string  `json:"issuer"`
+		Note   string  `json:"note"`
+		Icon   *string `json:"icon"`
+		Info   info    `json:"info"`
+	}
+	db := struct {
+		Version int           `json:"version"`
+		Entries []aegisExport `json:"entries"`
+	}{Version: 2, Entries: []aegisExport{}}
+	for _, p := range entries {
+		var (
+			c  = p.generator()
+			id = make([]byte, 16)
+			e  = aegisExport{
+				Type:   "totp",
+				Name:   p.account(),
+				Issuer: p.issuer,
+				Info: info{
+					Secret: encodeSecret(p.key),
+					Algo:   c.Algorithm.String(),
+					Digits: cmp.Or(c.Digits, otp.DefaultDigits),
+				},
+			}
+		)
+		if _, err := rand.Read(id); err != nil {
+			return err
+		}
+		// Aegis identifies the entries by a random (version 4) UUID.
+		id[6], id[8] = id[6]&0x0F|0x40, id[8]&0x3F|0x80
+		e.UUID = fmt.Sprintf("%x-%x-%x-%x-%x", id[0:4], id[4:6], id[6:8], id[8:10], id[10:16])
+		switch {
+		case p.hotp:
+			e.Type = "hotp"
+			e.Info.Counter = &p.counter
+		case p.encoder == "steam":
+			e.Type = "steam"
+			fallthrough
+		default:
+			e.Info.Period = int(cmp.Or(c.Period, otp.DefaultPeriod) / time.Second)
+		}
+		db.Entries = append(db.Entries, e)
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "    ")
+	return enc.Encode(map[string]any{
+		"version": 1,
+		"header":  map[string]any{"slots": nil, "params": nil},
+		"db":      db,
+	})
+}
+
+// readAndOTP reads the entries of an unencrypted andOTP backup.
+func readAndOTP(data []byte) ([]entry, error) {
+	var backup []struct {
+		Secret    string `json:"secret"`
+		Issuer    string `json:"issuer"`
+		Label     string `json:"label"`
+		Digits    int    `json:"digits"`
+		Type      string `json:"type"`
+		Algorithm string `json:"algorithm"`
+		Period    int    `json:"period"`
+		Counter   uint64 `json:"counter"`
+	}
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, err
+	}
+	var entries []entry
+	for _, e := range backup {
+		entries = append(entries, entry{
+			kind:      e.Type,
+			issuer:    e.Issuer,
+			account:   e.Label,
+			secret:    e.Secret,
+			algorithm: e.Algorithm,
+			digits:    e.Digits,
+			period:    e.Period,
+			counter:   e.Counter,
+		})
+	}
+	return entries, nil
+}
+
+// readTwoFAS reads the entries of an unencrypted 2FAS backup.
+func readTwoFAS(data []byte) ([]entry, error) {
+	var backup struct {
+		Services []struct {
+			Name   string `json:"name"`
+			Secret string `json:"secret"`
+			OTP    struct {
+				Account   string `json:"account"`
+				Label     string `json:"label"`
+				Issuer    string `json:"issuer"`
+				Digits    int    `json:"digits"`
+				Period    int    `json:"period"`
+				Algorithm string `json:"algorithm"`
+				TokenType string `json:"tokenType"`
+				Counter   uint64 `json:"counter"`
+			} `json:"otp"`
+		} `json:"services"`
+		ServicesEncrypted string `json:"servicesEncrypted"`
+	}
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, err
+	}
+	if backup.ServicesEncrypted != "" && len(backup.Services) == 0 {
+		return nil, fmt.Errorf("encrypted 2FAS backups are not supported, export the backup without a password")
+	}
+	var entries []entry
+	for _, s := range backup.Services {
+		issuer := s.OTP.Issuer
+		if issuer == "" {
+			issuer = s.Name
+		}
+		account := s.OTP.Account
+		if account == "" {
+			account = s.OTP.Label
+		}
+		entries = append(entries, entry{
+			kind:      s.OTP.TokenType,
+			issuer:    issuer,
+			account:   account,
+			secret:    s.Secret,
+			algorithm: s.OTP.Algorithm,
+			digits:    s.OTP.Digits,
+			period:    s.OTP.Period,
+			counter:   s.OTP.Counter,
+		})
+	}
+	return entries, nil
+}
+
+// readFreeOTP reads the entries of a FreeOTP+ backup, which holds the
+// secrets as arrays of signed bytes.
+func readFreeOTP(data []byte) ([]entry, error) {
+	var backup struct {
+		Tokens []struct {
+			Algo      string `json:"algo"`
+			Counter   uint64 `json:"counter"`
+			Digits    int    `json:"digits"`
+			IssuerExt string `json:"issuerExt"`
+			Label     string `json:"label"`
+			Period    int    `json:"period"`
+			Secret    []int  `json:"secret"`
+			Type      string `json:"type"`
+		} `json:"tokens"`
+	}
+	if err := json.Unmarshal(data, &backup); err != nil {
+		return nil, err
+	}
+	var entries []entry
+	for _, t := range backup.Tokens {
+		key := make([]byte, len(t.Secret))
+		for i, b := range t.Secret {
+			key[i] = byte(b)
+		}
+		entries = append(entries, entry{
+			kind:      t.Type,
+			issuer:    t.IssuerExt,
+			account:   t.Label,
+			secret:    encodeSecret(key),
+			algorithm: t.Algo,
+			digits:    t.Digits,
+			period:    t.Period,
+			counter:   t.Counter,
+		})
+	}
+	return entries, nil
+}
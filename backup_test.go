@@ -0,0 +1,138 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thimc/totp/otp"
+)
+
+// imported is what is compared of an imported entry.
+type imported struct {
+	name      string
+	issuer    string
+	key       string
+	algorithm otp.Algorithm
+	digits    int
+	period    time.Duration
+	hotp      bool
+	counter   uint64
+	encoder   string
+}
+
+const seed = "12345678901234567890"
+
+func TestReadBackup(t *testing.T) {
+	var (
+		aegis = []imported{
+			{name: "ACME:john@example.com", issuer: "ACME", key: seed, algorithm: otp.SHA256, digits: 8, period: time.Minute},
+			{name: "counter", key: seed, algorithm: otp.SHA1, digits: 6, hotp: true, counter: 7},
+			{name: "Steam:gabe", issuer: "Steam", key: seed, algorithm: otp.SHA1, digits: 5, period: 30 * time.Second, encoder: "steam"},
+		}
+		tests = []struct {
+			file        string
+			passphrases []string
+			want        []imported
+		}{
+			{"aegis.json", nil, aegis},
+			{"aegis-encrypted.json", []string{"test"}, aegis},
+			{"andotp.json", nil, []imported{
+				{name: "Andco:me", issuer: "Andco", key: seed, algorithm: otp.SHA512, digits: 8, period: 30 * time.Second},
+				{name: "andcounter", key: seed, algorithm: otp.SHA1, digits: 6, hotp: true, counter: 3},
+				{name: "Steam:andsteam", issuer: "Steam", key: seed, algorithm: otp.SHA1, digits: 5, period: 30 * time.Second, encoder: "steam"},
+			}},
+			{"2fas.json", nil, []imported{
+				{name: "TwoCo:bob", issuer: "TwoCo", key: seed, algorithm: otp.SHA1, digits: 6, period: 30 * time.Second},
+				{name: "Counter Inc:carol", issuer: "Counter Inc", key: seed, algorithm: otp.SHA256, digits: 8, hotp: true, counter: 2},
+			}},
+			{"freeotp.json", nil, []imported{
+				{name: "Free:al", issuer: "Free", key: "\xff\x80\x00\x7f\x01\x02\x03\x04\x05\x06", algorithm: otp.SHA256, digits: 8, period: time.Minute},
+				{name: "freecounter", key: seed, algorithm: otp.SHA1, digits: 6, period: 30 * time.Second, hotp: true, counter: 11},
+			}},
+		}
+	)
+	for _, tt := range tests {
+		t.Run(tt.file, func(t *testing.T) {
+			usePassphrases(t, tt.passphrases...)
+			data, err := os.ReadFile(filepath.Join("testdata", tt.file))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !isBackup(data) {
+				t.Fatal("isBackup = false")
+			}
+			ps, err := readBackup(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(ps) != len(tt.want) {
+				t.Fatalf("got %d entries, want %d", len(ps), len(tt.want))
+			}
+			for i, p := range ps {
+				got := imported{
+					name:      p.name,
+					issuer:    p.issuer,
+					key:       string(p.key),
+					algorithm: p.config.Algorithm,
+					digits:    p.config.Digits,
+					period:    p.config.Period,
+					hotp:      p.hotp,
+					counter:   p.counter,
+					encoder:   p.encoder,
+				}
+				if got != tt.want[i] {
+					t.Errorf("entry %d = %+v, want %+v", i, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
+
+func TestReadBackupErrors(t *testing.T) {
+	tests := []struct {
+		name        string
+		data        string
+		passphrases []string
+		err         string
+	}{
+		{"wrong passphrase", "", []string{"wrong"}, "wrong passphrase"},
+		{"encrypted 2FAS", `{"services":[],"servicesEncrypted":"abc"}`, nil, "encrypted 2FAS backups are not supported"},
+		{"unknown", `{"entries":[]}`, nil, "unknown backup format"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			usePassphrases(t, tt.passphrases...)
+			data := []byte(tt.data)
+			if len(data) == 0 {
+				var err error
+				if data, err = os.ReadFile(filepath.Join("testdata", "aegis-encrypted.json")); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if _, err := readBackup(data); err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("readBackup = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestReadBackupInvalidEntries(t *testing.T) {
+	data := []byte(`[
+		{"secret": "GEZDGNBVGY3TQOJQ", "label": "digits", "digits": -1, "type": "TOTP"},
+		{"secret": "GEZDGNBVGY3TQOJQ", "label": "period", "period": -5, "type": "TOTP"},
+		{"secret": "GEZDGNBVGY3TQOJQ", "label": "algorithm", "algorithm": "MD5", "type": "TOTP"},
+		{"secret": "GEZDGNBVGY3TQOJQ", "label": "type", "type": "MOTP"},
+		{"secret": "!!", "label": "secret", "type": "TOTP"},
+		{"secret": "GEZDGNBVGY3TQOJQ", "label": "valid", "type": "TOTP"}
+	]`)
+	ps, err := readBackup(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != 1 || ps[0].name != "valid" {
+		t.Errorf("got %d entries, want only the valid one", len(ps))
+	}
+}
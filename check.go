@@ -0,0 +1,36 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+// minKeySize is the minimum length in bytes of a secret. RFC4226
+// requires 128 bits, but 80 bit secrets are still handed out by many
+// providers and are accepted by all authenticator apps.
+const minKeySize = 80 / 8
+
+// check reports the problems of the secrets file: lines that couldn't
+// be parsed, duplicate names and secrets that are too short. It fails
+// if any were found, so that it can be used to validate secrets files
+// in scripts.
+func check() error {
+	if *passStore {
+		return fmt.Errorf("only secrets files can be checked")
+	}
+	found := problems
+	for _, p := range providers {
+		if len(p.key) < minKeySize {
+			err := fmt.Errorf("secret of %q is %d bits long, at least %d are required", p.name, len(p.key)*8, minKeySize*8)
+			found = append(found, problem{line: p.line, err: err})
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool { return found[i].line < found[j].line })
+	for _, pr := range found {
+		fmt.Printf("line %d: %s\n", pr.line+1, pr.err)
+	}
+	if len(found) > 0 {
+		return fmt.Errorf("%d problems found", len(found))
+	}
+	return nil
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// clipboardTool is a program which manages the clipboard of the
+// display server named by the environment variable env.
+type clipboardTool struct {
+	env                string
+	copy, paste, clear []string
+}
+
+// clipboardTools lists the supported programs in order of preference.
+var clipboardTools = []clipboardTool{
+	{
+		env:   "WAYLAND_DISPLAY",
+		copy:  []string{"wl-copy"},
+		paste: []string{"wl-paste", "-n"},
+		clear: []string{"wl-copy", "--clear"},
+	},
+	{
+		env:   "DISPLAY",
+		copy:  []string{"xclip", "-selection", "clipboard"},
+		paste: []string{"xclip", "-selection", "clipboard", "-o"},
+		clear: []string{"xclip", "-selection", "clipboard", "/dev/null"},
+	},
+	{
+		env:   "DISPLAY",
+		copy:  []string{"xsel", "-ib"},
+		paste: []string{"xsel", "-ob"},
+		clear: []string{"xsel", "-cb"},
+	},
+}
+
+// clipboard returns the first clipboard program that is installed
+// for the running display server, or nil if there is none.
+func clipboard() *clipboardTool {
+	for i, t := range clipboardTools {
+		if os.Getenv(t.env) == "" {
+			continue
+		}
+		if _, err := exec.LookPath(t.copy[0]); err == nil {
+			return &clipboardTools[i]
+		}
+	}
+	return nil
+}
+
+// copyText places s in the clipboard. Terminals are asked to do so
+// using OSC 52 if no clipboard program is available.
+func copyText(s string) error {
+	if t := clipboard(); t != nil {
+		cmd := exec.Command(t.copy[0], t.copy[1:]...)
+		cmd.Stdin = strings.NewReader(s)
+		return cmd.Run()
+	}
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return fmt.Errorf("no clipboard program or terminal found")
+	}
+	defer tty.Close()
+	return copyOSC52(tty, s)
+}
+
+// copyOSC52 places s in the clipboard of the terminal w using the
+// OSC 52 escape sequence.
+func copyOSC52(w io.Writer, s string) error {
+	_, err := fmt.Fprintf(w, "\x1b]52;c;%s\a", base64.StdEncoding.EncodeToString([]byte(s)))
+	return err
+}
+
+// copyClear places s in the clipboard and, unless -C is 0, starts a
+// background process which clears it again once -C has passed.
+func copyClear(s string) error {
+	if err := copyText(s); err != nil {
+		return err
+	}
+	if *cliptime <= 0 {
+		return nil
+	}
+	self, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	// The password is handed over on the standard input rather than
+	// as an argument so that it doesn't show up in the process list.
+	cmd := exec.Command(self, "-C", cliptime.String(), "clipclear")
+	w, err := cmd.StdinPipe()
+	if err != nil {
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		return err
+	}
+	if _, err := io.WriteString(w, s); err != nil {
+		return err
+	}
+	if err := w.Close(); err != nil {
+		return err
+	}
+	return cmd.Process.Release()
+}
+
+// clipclear waits for -C to pass and then clears the clipboard if it
+// still holds the text read from the standard input.
+func clipclear() error {
+	signal.Ignore(syscall.SIGHUP, syscall.SIGINT)
+	s, err := io.ReadAll(os.Stdin)
+	if err != nil {
+		return err
+	}
+	time.Sleep(*cliptime)
+	if t := clipboard(); t != nil {
+		cur, err := exec.Command(t.paste[0], t.paste[1:]...).Output()
+		if err != nil || !bytes.Equal(cur, s) {
+			return err
+		}
+		return exec.Command(t.clear[0], t.clear[1:]...).Run()
+	}
+	tty, err := os.OpenFile("/dev/tty", os.O_WRONLY, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+	// An invalid base64 payload makes the terminal clear its
+	// clipboard.
+	_, err = fmt.Fprint(tty, "\x1b]52;c;!\a")
+	return err
+}
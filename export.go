@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// warnExport reports an entry that is left out of the export.
+func warnExport(err error) {
+	fmt.Fprintf(os.Stderr, "export: %s, skipping\n", err)
+}
+
+// confirm asks the question prompt on the terminal and reports whether
+// it was answered with yes.
+func confirm(prompt string) (bool, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return false, err
+	}
+	defer tty.Close()
+	fmt.Fprint(tty, prompt)
+	answer, err := bufio.NewReader(tty).ReadString('\n')
+	if err != nil && err != io.EOF {
+		return false, err
+	}
+	switch strings.ToLower(strings.TrimSpace(answer)) {
+	case "y", "yes":
+		return true, nil
+	}
+	return false, nil
+}
+
+// export prints the secrets in format, which is either uri for key
+// URIs, aegis for an unencrypted Aegis vault or google for the
+// migration URIs of Google Authenticator. As the secrets are written
+// in plain text, the export has to be confirmed unless -y is given.
+func export(format string) error {
+	switch format {
+	case "uri", "aegis", "google":
+	default:
+		return fmt.Errorf("unsupported format %q", format)
+	}
+	if !*yes {
+		ok, err := confirm(fmt.Sprintf("Export %d secrets in plain text? [y/N] ", len(providers)))
+		if err != nil {
+			return fmt.Errorf("confirm: %w (use -y to skip the confirmation)", err)
+		}
+		if !ok {
+			return fmt.Errorf("cancelled")
+		}
+	}
+	w := bufio.NewWriter(os.Stdout)
+	switch format {
+	case "uri":
+		for _, p := range providers {
+			fmt.Fprintln(w, p.uri())
+		}
+	case "aegis":
+		if err := writeAegis(w, providers); err != nil {
+			return err
+		}
+	case "google":
+		for _, s := range migrationURIs(providers) {
+			fmt.Fprintln(w, s)
+		}
+	}
+	return w.Flush()
+}
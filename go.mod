@@ -1,3 +1,18 @@
 module github.com/thimc/totp
 
 go 1.22.4
+
+require (
+	github.com/ProtonMail/go-crypto v1.1.6
+	github.com/makiuchi-d/gozxing v0.1.1
+	golang.org/x/crypto v0.31.0
+	golang.org/x/term v0.27.0
+	rsc.io/qr v0.2.0
+)
+
+require (
+	github.com/cloudflare/circl v1.3.7 // indirect
+	golang.org/x/sys v0.28.0 // indirect
+	golang.org/x/text v0.21.0 // indirect
+	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
+)
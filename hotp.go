@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// hotp prints the next password of the counter-based entry matching
+// query.
+func hotp(query string) error {
+	p, err := lookup(query)
+	if err != nil {
+		return err
+	}
+	if !p.hotp {
+		return fmt.Errorf("%q is not counter-based", p.name)
+	}
+	secret, err := advance(p)
+	if err != nil {
+		return err
+	}
+	fmt.Println(secret)
+	return nil
+}
+
+// advance returns the next password of the counter-based entry p and
+// stores the incremented counter in the secrets file.
+func advance(p *provider) (string, error) {
+	secret := p.generator().HOTP(p.counter)
+	// The counter is stored before the password is handed out so
+	// that a failed write never hands out the same password twice.
+	err := editSecrets(false, func(lines []string) ([]string, error) {
+		var err error
+		lines[p.line], err = setCounter(lines[p.line], p.counter+1)
+		return lines, err
+	})
+	if err != nil {
+		return "", err
+	}
+	p.counter++
+	return secret, nil
+}
+
+// setCounter returns line, a tab separated entry or an otpauth:// URI,
+// with its counter set to c.
+func setCounter(line string, c uint64) (string, error) {
+	if strings.HasPrefix(line, "otpauth://") {
+		u, err := url.Parse(line)
+		if err != nil {
+			return "", err
+		}
+		q := u.Query()
+		q.Set("counter", strconv.FormatUint(c, 10))
+		u.RawQuery = q.Encode()
+		return u.String(), nil
+	}
+	var (
+		parts = strings.Split(line, "\t")
+		field = "counter=" + strconv.FormatUint(c, 10)
+	)
+	for i, part := range parts[2:] {
+		if strings.HasPrefix(part, "counter=") {
+			parts[i+2] = field
+			return strings.Join(parts, "\t"), nil
+		}
+	}
+	return strings.Join(append(parts, field), "\t"), nil
+}
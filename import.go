@@ -0,0 +1,100 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+)
+
+// warnImport reports an entry that is left out of the import.
+func warnImport(err error) {
+	fmt.Fprintf(os.Stderr, "import: %s, skipping\n", err)
+}
+
+// importEntries adds the entries of the sources to the secrets file. A
+// source is an otpauth:// or otpauth-migration:// URI, a file holding
+// such URIs one per line, a PNG or JPEG image of a QR code holding one
+// or the backup of an authenticator app. The entries are written as key URIs,
+// entries whose name is already taken are left out.
+func importEntries(sources []string) error {
+	var (
+		entries    []provider
+		migrations []string
+	)
+	for _, src := range sources {
+		uris := []string{src}
+		if !strings.Contains(src, "://") {
+			data, err := os.ReadFile(src)
+			if err != nil {
+				return err
+			}
+			switch {
+			case isBackup(data):
+				b, err := readBackup(data)
+				if err != nil {
+					return fmt.Errorf("%s: %w", src, err)
+				}
+				entries = append(entries, b...)
+				continue
+			case isImage(data):
+				text, err := scanQR(data)
+				if err != nil {
+					return fmt.Errorf("%s: %w", src, err)
+				}
+				uris = []string{text}
+			default:
+				uris = strings.Fields(string(data))
+			}
+		}
+		for _, s := range uris {
+			switch {
+			case strings.HasPrefix(s, migrationPrefix):
+				migrations = append(migrations, s)
+			case strings.HasPrefix(s, "otpauth://"):
+				p, err := parseURI(s, provider{})
+				if err == nil {
+					err = p.decode()
+				}
+				if err != nil {
+					return fmt.Errorf("invalid uri: %w", err)
+				}
+				entries = append(entries, p)
+			default:
+				return fmt.Errorf("%s: not an otpauth:// or otpauth-migration:// URI", src)
+			}
+		}
+	}
+	m, err := readMigrations(migrations)
+	if err != nil {
+		return err
+	}
+	entries = append(entries, m...)
+
+	var (
+		lines []string
+		taken = make(map[string]bool)
+	)
+	for _, p := range entries {
+		if err := validName(p.name); err != nil {
+			warnImport(err)
+			continue
+		}
+		if taken[p.name] {
+			warnImport(fmt.Errorf("%q is imported twice", p.name))
+			continue
+		}
+		taken[p.name] = true
+		lines = append(lines, p.uri())
+	}
+	if len(lines) == 0 {
+		return fmt.Errorf("there are no entries to import")
+	}
+	err = editSecrets(true, func(l []string) ([]string, error) {
+		return append(l, lines...), nil
+	})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Imported %d of %d entries.\n", len(lines), len(entries))
+	return nil
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+var (
+	errNotFound  = errors.New("not found")
+	errAmbiguous = errors.New("ambiguous")
+)
+
+// lookup returns the entry matching query. An exact match
+// is preferred over a case-insensitive one, which is preferred over a
+// prefix match, which in turn is preferred over a fuzzy match where
+// the characters of query appear in order in the name.
+func lookup(query string) (*provider, error) {
+	if p := find(query); p != nil {
+		return p, nil
+	}
+	q := strings.ToLower(query)
+	matchers := []func(name string) bool{
+		func(name string) bool { return name == q },
+		func(name string) bool { return strings.HasPrefix(name, q) },
+		func(name string) bool { return fuzzy(name, q) },
+	}
+	for _, match := range matchers {
+		var found []*provider
+		for _, p := range providers {
+			if match(strings.ToLower(p.name)) {
+				found = append(found, p)
+			}
+		}
+		switch len(found) {
+		case 0:
+			continue
+		case 1:
+			return found[0], nil
+		}
+		names := make([]string, len(found))
+		for i, p := range found {
+			names[i] = p.name
+		}
+		return nil, fmt.Errorf("%q is %w: %s", query, errAmbiguous, strings.Join(names, ", "))
+	}
+	return nil, fmt.Errorf("%q %w", query, errNotFound)
+}
+
+// find returns the entry named name, or nil if there is none.
+func find(name string) *provider {
+	for _, p := range providers {
+		if p.name == name {
+			return p
+		}
+	}
+	return nil
+}
+
+// fuzzy reports whether the characters of s appear in order in name.
+func fuzzy(name, s string) bool {
+	for _, r := range s {
+		i := strings.IndexRune(name, r)
+		if i < 0 {
+			return false
+		}
+		name = name[i+len(string(r)):]
+	}
+	return true
+}
+
+// get prints the current password of the entry matching query, or
+// copies it to the clipboard if -c is specified. The counter of
+// counter-based entries is incremented.
+func get(query string) error {
+	p, err := lookup(query)
+	if err != nil {
+		return err
+	}
+	if err := touch(p.name); err != nil {
+		fmt.Fprintf(os.Stderr, "recent: %s\n", err)
+	}
+	secret := p.generator().Now()
+	if p.hotp {
+		if secret, err = advance(p); err != nil {
+			return err
+		}
+	}
+	if !*clip {
+		fmt.Println(secret)
+		return nil
+	}
+	if err := copyClear(secret); err != nil {
+		return err
+	}
+	if *cliptime > 0 {
+		fmt.Printf("Copied %s to clipboard. Will clear in %s.\n", p.name, *cliptime)
+	} else {
+		fmt.Printf("Copied %s to clipboard.\n", p.name)
+	}
+	return nil
+}
@@ -2,70 +2,109 @@
 package main
 
 import (
-	"bufio"
-	"crypto/hmac"
-	"crypto/sha1"
-	"encoding/base32"
-	"encoding/binary"
+	"errors"
 	"flag"
 	"fmt"
-	"math"
 	"os"
 	"path/filepath"
-	"strings"
 	"time"
+
+	"github.com/thimc/totp/otp"
 )
 
 var (
-	providers = make(map[string]string)
+	providers []*provider
+	input     []byte // the secrets as read from -f or standard input
 	secrets   = flag.String("f", "", "file path to the secrets file")
-	datefmt   = flag.String("D", "15:04:06", "date format of the next generation")
+	keyring   = flag.String("k", "", "file path to the OpenPGP secret keys decrypting the secrets file")
+	passStore = flag.Bool("p", false, "read the secrets from the password store of pass(1)")
+	algorithm = flag.String("a", "SHA1", "default HMAC algorithm (SHA1, SHA256 or SHA512)")
+	datefmt   = flag.String("D", "15:04:05", "date format of the next generation")
 	digits    = flag.Int("d", 6, "amount of digits in the passwords")
-	interval  = flag.Int("i", 30, "delay (in seconds) between each generation")
+	interval  = flag.Int("i", 30, "default period (in seconds) of the passwords")
 	once      = flag.Bool("o", false, "generate passwords once")
+	jsonout   = flag.Bool("json", false, "print the passwords as newline-delimited JSON")
+	order     = flag.String("s", "file", "sort order of the entries (file, name, issuer or recent)")
+	tuimode   = flag.Bool("t", false, "run the interactive full-screen interface")
+	clip      = flag.Bool("c", false, "copy the password to the clipboard instead of printing it (get)")
+	cliptime  = flag.Duration("C", 45*time.Second, "time after which the copied password is cleared from the clipboard, 0 to keep it")
+	skew      = flag.Int("w", 1, "time steps of clock drift accepted by verify")
+	yes       = flag.Bool("y", false, "export the secrets without asking for confirmation (export)")
 )
 
-// TOTP generates a time-based one-time password (TOTP).
-func TOTP(when time.Time, key []byte, interval time.Duration) (string, error) {
-	var (
-		hash = hmac.New(sha1.New, key)
-		buf  = make([]byte, 8)
-		now  = uint64(when.Unix() / int64(interval.Seconds()))
-	)
-	binary.BigEndian.PutUint64(buf, now)
-	if _, err := hash.Write(buf); err != nil {
-		return "", err
-	}
-	var (
-		mac    = hash.Sum(nil)
-		offset = mac[len(mac)-1] & 0xF
-		d      = uint(binary.BigEndian.Uint32(mac[offset:offset+4]) & 0x7FFFFFFF)
-	)
-	return fmt.Sprintf("%0*d", *digits, d%uint(math.Pow10(*digits))), nil
+// command is a subcommand taking between min and max arguments, or
+// any number of arguments if max is negative. Standalone commands are
+// run without reading the secrets, create commands may be run on a
+// secrets file that doesn't exist yet. Check commands report the
+// problems of the secrets file themselves.
+type command struct {
+	min, max   int
+	run        func(args []string) error
+	standalone bool
+	create     bool
+	check      bool
 }
 
-func parse(f *os.File) error {
-	s := bufio.NewScanner(f)
-	for s.Scan() {
-		parts := strings.Split(s.Text(), "\t")
-		if len(parts) != 2 {
-			fmt.Fprintf(os.Stderr, "invalid line: %q, ignoring\n", s.Text())
-			continue
-		}
-		providers[parts[0]] = parts[1]
-	}
-	if err := s.Err(); err != nil {
-		return err
-	}
-	if len(providers) < 1 {
-		return fmt.Errorf("invalid data provided")
+var commands = map[string]command{
+	"get":    {min: 1, max: 1, run: func(args []string) error { return get(args[0]) }},
+	"hotp":   {min: 1, max: 1, run: func(args []string) error { return hotp(args[0]) }},
+	"verify": {min: 2, max: 2, run: func(args []string) error { return verify(args[0], args[1]) }},
+
+	"list":   {run: func([]string) error { return list() }},
+	"add":    {min: 2, max: -1, run: func(args []string) error { return addEntry(args[0], args[1], args[2:]) }, create: true},
+	"rm":     {min: 1, max: 1, run: func(args []string) error { return removeEntry(args[0]) }},
+	"rename": {min: 2, max: 2, run: func(args []string) error { return renameEntry(args[0], args[1]) }},
+	"check":  {run: func([]string) error { return check() }, check: true},
+	"import": {min: 1, max: -1, run: func(args []string) error { return importEntries(args) }, create: true},
+	"export": {max: 1, run: func(args []string) error { return export(append(args, "uri")[0]) }},
+	"qr":     {min: 1, max: 2, run: func(args []string) error { return showQR(args[0], append(args, "")[1]) }},
+
+	"encrypt": {min: 1, max: 1, run: func(args []string) error { return encrypt(args[0]) }},
+	"rekey":   {run: func([]string) error { return rekey() }},
+
+	// clipclear is run in the background by copyClear and is not
+	// meant to be used directly.
+	"clipclear": {run: func([]string) error { return clipclear() }, standalone: true},
+}
+
+// fail reports the error of the command cmd and exits. Entries that
+// couldn't be found and ambiguous names have exit statuses of their
+// own.
+func fail(cmd string, err error) {
+	fmt.Fprintf(os.Stderr, "%s: %s\n", cmd, err)
+	switch {
+	case errors.Is(err, errNotFound):
+		os.Exit(2)
+	case errors.Is(err, errAmbiguous):
+		os.Exit(3)
 	}
-	return nil
+	os.Exit(1)
 }
 
 func usage() {
+	fmt.Fprintf(os.Stderr, "usage: %s [flags] [command [args]]\n", filepath.Base(os.Args[0]))
 	fmt.Fprintf(os.Stderr, "%s will read from standard input if -f is not specified.\n", filepath.Base(os.Args[0]))
-	fmt.Fprintf(os.Stderr, "File is expected to be tab separated containing the display\nname and the secret itself.\n\n")
+	fmt.Fprintf(os.Stderr, "File is expected to be tab separated containing the display\nname and the secret itself, optionally followed by key=value\nfields (algorithm, digits, period, counter, encoder, encoding). Lines may also be otpauth:// URIs.\n\n")
+	fmt.Fprint(os.Stderr, `commands:
+  get name                    print the password of an entry
+  hotp name                   print the next password of a counter-based entry
+  verify name code            check a code against an entry
+  list                        print the names of the entries
+  add name secret [key=value] add an entry to the secrets file
+  rm name                     remove an entry from the secrets file
+  rename name newname         rename an entry of the secrets file
+  check                       report the problems of the secrets file
+  import source...            add the entries of otpauth:// or Google
+                              Authenticator export URIs, files or QR code
+                              images of them, or Aegis, andOTP, 2FAS and
+                              FreeOTP+ backups
+  export [uri|aegis|google]   print the secrets as otpauth:// URIs, an Aegis
+                              vault or Google Authenticator export URIs
+  qr name [file.png|file.svg] show the QR code of an entry or write it to file
+  encrypt file                write the secrets to a new encrypted file
+  rekey                       change the passphrase of the secrets file
+
+`)
 	flag.PrintDefaults()
 	os.Exit(1)
 }
@@ -73,41 +112,76 @@ func usage() {
 func main() {
 	flag.Usage = usage
 	flag.Parse()
-	var f = os.Stdin
-	if *secrets != "" {
-		var err error
-		f, err = os.Open(*secrets)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "open: %s\n", err)
+	cmd, ok := commands[flag.Arg(0)]
+	if n := flag.NArg() - 1; flag.NArg() > 0 && (!ok || n < cmd.min || (cmd.max >= 0 && n > cmd.max)) {
+		usage()
+	}
+	if cmd.standalone {
+		if err := cmd.run(flag.Args()[1:]); err != nil {
+			fail(flag.Arg(0), err)
+		}
+		return
+	}
+	a, err := otp.ParseAlgorithm(*algorithm)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	if *digits < 1 || *digits > otp.MaxDigits {
+		fmt.Fprintf(os.Stderr, "invalid digits %d, expected 1 to %d\n", *digits, otp.MaxDigits)
+		os.Exit(1)
+	}
+	if *interval < 1 {
+		fmt.Fprintf(os.Stderr, "invalid period %d\n", *interval)
+		os.Exit(1)
+	}
+	def := provider{
+		config: otp.Config{
+			Algorithm: a,
+			Digits:    *digits,
+			Period:    time.Second * time.Duration(*interval),
+		},
+	}
+	if err := load(def, cmd); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+	if err := sortProviders(*order); err != nil {
+		fmt.Fprintf(os.Stderr, "sort: %s\n", err)
+		os.Exit(1)
+	}
+	if flag.NArg() > 0 {
+		if err := cmd.run(flag.Args()[1:]); err != nil {
+			fail(flag.Arg(0), err)
+		}
+		return
+	}
+	if *tuimode {
+		if err := tui(); err != nil {
+			fmt.Fprintf(os.Stderr, "tui: %s\n", err)
 			os.Exit(1)
 		}
-		defer f.Close()
+		return
 	}
-	if err := parse(f); err != nil {
-		fmt.Fprintf(os.Stderr, "parse: %s\n", err)
+	if len(statuses(time.Now())) == 0 {
+		fmt.Fprintf(os.Stderr, "no time-based entries, counter-based ones are shown by hotp\n")
 		os.Exit(1)
 	}
-	var (
-		dur = time.Second * time.Duration(*interval)
-		t   = time.NewTicker(dur)
-	)
-	for ; true; <-t.C {
-		fmt.Printf("%s - Next in %s\n", time.Now().Format(*datefmt), dur)
-		for name, key := range providers {
-			decoded, err := base32.StdEncoding.DecodeString(string(key))
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "base32 decoding failed: %q (%s)\n", err, name)
-				decoded = []byte(key)
-			}
-			secret, err := TOTP(time.Now(), decoded, dur)
-			if err != nil {
-				fmt.Fprintf(os.Stderr, "totp: %q", err)
-				continue
+	for {
+		now := time.Now()
+		if *jsonout {
+			if err := printJSON(os.Stdout, now); err != nil {
+				fmt.Fprintf(os.Stderr, "json: %s\n", err)
+				os.Exit(1)
 			}
-			fmt.Printf("%-25s %s\n", name, secret)
+		} else {
+			printText(os.Stdout, now)
 		}
 		if *once {
 			break
 		}
+		// Passwords are regenerated as soon as one of them
+		// expires, which lines up with the period boundaries.
+		time.Sleep(refresh(now))
 	}
 }
@@ -0,0 +1,180 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// editSecrets replaces the lines of the secrets file given by -f with
+// the ones returned by fn, backing up the previous file first if
+// backup is set. Entries refer to the lines of the file they were read
+// from, so the file must not have changed since.
+func editSecrets(backup bool, fn func(lines []string) ([]string, error)) error {
+	if readOnly != nil {
+		return readOnly
+	}
+	if *secrets == "" {
+		return fmt.Errorf("the secrets file can only be modified if -f is specified")
+	}
+	err := unchanged(*secrets)
+	if errors.Is(err, fs.ErrNotExist) && len(input) == 0 {
+		err, backup = nil, false
+	}
+	if err != nil {
+		return err
+	}
+	var lines []string
+	if len(input) > 0 {
+		lines = strings.Split(strings.TrimSuffix(string(input), "\n"), "\n")
+	}
+	if lines, err = fn(lines); err != nil {
+		return err
+	}
+	var out []byte
+	if len(lines) > 0 {
+		out = []byte(strings.Join(lines, "\n") + "\n")
+	}
+	if backup {
+		raw, err := os.ReadFile(*secrets)
+		if err != nil {
+			return err
+		}
+		if err := writeFile(*secrets+".bak", raw); err != nil {
+			return fmt.Errorf("backup: %w", err)
+		}
+	}
+	if err := writeSecrets(*secrets, out); err != nil {
+		return err
+	}
+	input = out
+	return nil
+}
+
+// unchanged checks that the secrets file at path still holds the
+// secrets that were read, which would be lost if it was overwritten.
+func unchanged(path string) error {
+	data, err := readSecrets(path)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(data, input) {
+		return fmt.Errorf("%s has been changed since it was read", path)
+	}
+	return nil
+}
+
+// validName checks that name can be used as the name of an entry in
+// the secrets file.
+func validName(name string) error {
+	switch {
+	case strings.TrimSpace(name) == "":
+		return fmt.Errorf("empty name")
+	case strings.ContainsAny(name, "\t\r\n"):
+		return fmt.Errorf("%q contains a tab or newline", name)
+	case strings.HasPrefix(name, "otpauth://"):
+		return fmt.Errorf("%q is mistaken for a URI", name)
+	case find(name) != nil:
+		return fmt.Errorf("%q already exists", name)
+	}
+	return nil
+}
+
+// list prints the names of the entries.
+func list() error {
+	for _, p := range providers {
+		fmt.Println(p.name)
+	}
+	return nil
+}
+
+// addEntry adds an entry for secret, with the given key=value
+// options, to the secrets file.
+func addEntry(name, secret string, options []string) error {
+	if err := validName(name); err != nil {
+		return err
+	}
+	for _, field := range append([]string{secret}, options...) {
+		if strings.ContainsAny(field, "\t\r\n") {
+			return fmt.Errorf("%q contains a tab or newline", field)
+		}
+	}
+	// The line is checked the same way it is parsed when loading.
+	line := strings.Join(append([]string{name, secret}, options...), "\t")
+	if _, err := parseLine(line, provider{}); err != nil {
+		return err
+	}
+	return editSecrets(true, func(lines []string) ([]string, error) {
+		return append(lines, line), nil
+	})
+}
+
+// findUnique returns the entry name. It fails if the name is used on
+// more than one line of the secrets file, as changing only the last of
+// them would bring back an earlier one.
+func findUnique(name string) (*provider, error) {
+	p := find(name)
+	if p == nil {
+		return nil, fmt.Errorf("%q %w", name, errNotFound)
+	}
+	if p.replaces {
+		return nil, fmt.Errorf("%q is used on more than one line, see the check command", name)
+	}
+	return p, nil
+}
+
+// removeEntry removes the entry name from the secrets file.
+func removeEntry(name string) error {
+	p, err := findUnique(name)
+	if err != nil {
+		return err
+	}
+	return editSecrets(true, func(lines []string) ([]string, error) {
+		return append(lines[:p.line], lines[p.line+1:]...), nil
+	})
+}
+
+// renameEntry renames the entry name of the secrets file to newname.
+func renameEntry(name, newname string) error {
+	p, err := findUnique(name)
+	if err != nil {
+		return err
+	}
+	if err := validName(newname); err != nil {
+		return err
+	}
+	return editSecrets(true, func(lines []string) ([]string, error) {
+		var err error
+		lines[p.line], err = renameLine(lines[p.line], newname)
+		return lines, err
+	})
+}
+
+// renameLine returns line, a tab separated entry or an otpauth:// URI,
+// with its name set to name. The label of a URI is replaced by name,
+// which is split into the issuer and the account if it contains a
+// colon.
+func renameLine(line, name string) (string, error) {
+	if !strings.HasPrefix(line, "otpauth://") {
+		parts := strings.Split(line, "\t")
+		parts[0] = name
+		return strings.Join(parts, "\t"), nil
+	}
+	u, err := url.Parse(line)
+	if err != nil {
+		return "", err
+	}
+	q := u.Query()
+	if issuer, _, ok := strings.Cut(name, ":"); ok {
+		q.Set("issuer", issuer)
+	} else {
+		q.Del("issuer")
+	}
+	u.Path = "/" + name
+	u.RawQuery = q.Encode()
+	return u.String(), nil
+}
@@ -0,0 +1,323 @@
+package main
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"fmt"
+	"math/rand/v2"
+	"net/url"
+	"strings"
+
+	"github.com/thimc/totp/otp"
+)
+
+// The export of Google Authenticator is made up of one or more
+// otpauth-migration://offline?data=... URIs, each holding a base64
+// encoded protocol buffer message:
+//
+//	message MigrationPayload {
+//		repeated OtpParameters otp_parameters = 1;
+//		int32 version = 2;
+//		int32 batch_size = 3;
+//		int32 batch_index = 4;
+//		int32 batch_id = 5;
+//	}
+//
+//	message OtpParameters {
+//		bytes secret = 1;
+//		string name = 2;
+//		string issuer = 3;
+//		Algorithm algorithm = 4; // SHA1 = 1, SHA256, SHA512, MD5
+//		DigitCount digits = 5;   // SIX = 1, EIGHT
+//		OtpType type = 6;        // HOTP = 1, TOTP
+//		int64 counter = 7;
+//	}
+//
+// Exports with many entries are split into batches sharing a batch_id.
+const migrationPrefix = "otpauth-migration://"
+
+// migration is a decoded MigrationPayload.
+type migration struct {
+	providers []provider
+	size      int
+	index     int
+	id        int
+}
+
+// pbFields calls fn for every field of the protocol buffer message b,
+// passing varints as v and length-delimited fields as data. Fixed size
+// fields are skipped.
+func pbFields(b []byte, fn func(num int, v uint64, data []byte) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return fmt.Errorf("malformed field")
+		}
+		b = b[n:]
+		var (
+			num  = int(key >> 3)
+			v    uint64
+			data []byte
+		)
+		switch key & 7 {
+		case 0:
+			if v, n = binary.Uvarint(b); n <= 0 {
+				return fmt.Errorf("malformed varint")
+			}
+		case 1:
+			n = 8
+		case 2:
+			l, m := binary.Uvarint(b)
+			if m <= 0 || l > uint64(len(b)-m) {
+				return fmt.Errorf("malformed length")
+			}
+			data, n = b[m:m+int(l)], m+int(l)
+		case 5:
+			n = 4
+		default:
+			return fmt.Errorf("unsupported wire type %d", key&7)
+		}
+		if n > len(b) {
+			return fmt.Errorf("truncated message")
+		}
+		b = b[n:]
+		if err := fn(num, v, data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// parseMigration decodes the otpauth-migration:// URI s. Entries that
+// can't be represented are reported and left out.
+func parseMigration(s string) (*migration, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "otpauth-migration" || u.Host != "offline" {
+		return nil, fmt.Errorf("not a migration URI")
+	}
+	// A plus sign that wasn't escaped in the query is read as a space.
+	b, err := decodeSecret(strings.ReplaceAll(u.Query().Get("data"), " ", "+"), "base64")
+	if err != nil {
+		return nil, fmt.Errorf("data: %w", err)
+	}
+	m := &migration{size: 1}
+	err = pbFields(b, func(num int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			p, err := parseOtpParameters(data)
+			if err != nil {
+				return err
+			}
+			if p != nil {
+				m.providers = append(m.providers, *p)
+			}
+		case 3:
+			m.size = int(v)
+		case 4:
+			m.index = int(v)
+		case 5:
+			m.id = int(v)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("data: %w", err)
+	}
+	return m, nil
+}
+
+// parseOtpParameters decodes a single entry of a migration payload. It
+// returns nil for entries using a type or algorithm not supported.
+func parseOtpParameters(b []byte) (*provider, error) {
+	var (
+		p         provider
+		algorithm uint64
+		digits    uint64
+		kind      uint64
+	)
+	err := pbFields(b, func(num int, v uint64, data []byte) error {
+		switch num {
+		case 1:
+			p.key = data
+		case 2:
+			p.name = string(data)
+		case 3:
+			p.issuer = string(data)
+		case 4:
+			algorithm = v
+		case 5:
+			digits = v
+		case 6:
+			kind = v
+		case 7:
+			p.counter = v
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(p.key) == 0 {
+		return nil, fmt.Errorf("%q: missing secret", p.name)
+	}
+	p.secret = encodeSecret(p.key)
+	p.config.Period = otp.DefaultPeriod
+	switch algorithm {
+	case 0, 1:
+		p.config.Algorithm = otp.SHA1
+	case 2:
+		p.config.Algorithm = otp.SHA256
+	case 3:
+		p.config.Algorithm = otp.SHA512
+	default:
+		warnImport(fmt.Errorf("%q: unsupported algorithm", p.name))
+		return nil, nil
+	}
+	switch digits {
+	case 0, 1:
+		p.config.Digits = 6
+	case 2:
+		p.config.Digits = 8
+	default:
+		warnImport(fmt.Errorf("%q: unsupported number of digits", p.name))
+		return nil, nil
+	}
+	switch kind {
+	case 0, 2:
+	case 1:
+		p.hotp = true
+	default:
+		warnImport(fmt.Errorf("%q: unsupported type", p.name))
+		return nil, nil
+	}
+	p.setLabel(p.name)
+	return &p, nil
+}
+
+// readMigrations returns the entries of the migration URIs, checking
+// that no batch of a multi-batch export is missing.
+func readMigrations(uris []string) ([]provider, error) {
+	var (
+		entries []provider
+		batches = make(map[int]map[int]bool)
+		sizes   = make(map[int]int)
+	)
+	for _, s := range uris {
+		m, err := parseMigration(s)
+		if err != nil {
+			return nil, err
+		}
+		if batches[m.id] == nil {
+			batches[m.id] = make(map[int]bool)
+		}
+		if batches[m.id][m.index] {
+			return nil, fmt.Errorf("batch %d of export %d was given twice", m.index+1, m.id)
+		}
+		batches[m.id][m.index] = true
+		sizes[m.id] = m.size
+		entries = append(entries, m.providers...)
+	}
+	for id, seen := range batches {
+		if len(seen) < sizes[id] {
+			return nil, fmt.Errorf("only %d of the %d batches of export %d were given", len(seen), sizes[id], id)
+		}
+	}
+	return entries, nil
+}
+
+// appendVarint appends the varint field num with the value v to b.
+func appendVarint(b []byte, num int, v uint64) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3)
+	return binary.AppendUvarint(b, v)
+}
+
+// appendBytes appends the length-delimited field num holding data to b.
+func appendBytes(b []byte, num int, data []byte) []byte {
+	b = binary.AppendUvarint(b, uint64(num)<<3|2)
+	b = binary.AppendUvarint(b, uint64(len(data)))
+	return append(b, data...)
+}
+
+// batchSize is the number of entries per migration URI, which keeps
+// the QR codes of the URIs readable.
+const batchSize = 10
+
+// otpParameters encodes p as an OtpParameters message. It fails if
+// Google Authenticator can't represent the entry.
+func otpParameters(p *provider) ([]byte, error) {
+	var (
+		c                       = p.generator()
+		algorithm, digits, kind uint64
+	)
+	switch c.Algorithm {
+	case otp.SHA1:
+		algorithm = 1
+	case otp.SHA256:
+		algorithm = 2
+	case otp.SHA512:
+		algorithm = 3
+	}
+	switch c.Digits {
+	case 0, 6:
+		digits = 1
+	case 8:
+		digits = 2
+	default:
+		return nil, fmt.Errorf("%q: %d digits are not supported", p.name, c.Digits)
+	}
+	switch {
+	case p.encoder != "" && p.encoder != "decimal":
+		return nil, fmt.Errorf("%q: the %s encoder is not supported", p.name, p.encoder)
+	case p.hotp:
+		kind = 1
+	case c.Period != 0 && c.Period != otp.DefaultPeriod:
+		return nil, fmt.Errorf("%q: periods other than %s are not supported", p.name, otp.DefaultPeriod)
+	default:
+		kind = 2
+	}
+	var b []byte
+	b = appendBytes(b, 1, p.key)
+	b = appendBytes(b, 2, []byte(p.account()))
+	b = appendBytes(b, 3, []byte(p.issuer))
+	b = appendVarint(b, 4, algorithm)
+	b = appendVarint(b, 5, digits)
+	b = appendVarint(b, 6, kind)
+	b = appendVarint(b, 7, p.counter)
+	return b, nil
+}
+
+// migrationURIs encodes the entries as migration URIs holding up to
+// batchSize entries each. Entries that can't be represented are
+// reported and left out.
+func migrationURIs(entries []*provider) []string {
+	var params [][]byte
+	for _, p := range entries {
+		b, err := otpParameters(p)
+		if err != nil {
+			warnExport(err)
+			continue
+		}
+		params = append(params, b)
+	}
+	var (
+		uris  []string
+		id    = rand.Uint32() >> 1
+		count = (len(params) + batchSize - 1) / batchSize
+	)
+	for i := 0; i < count; i++ {
+		var b []byte
+		for _, p := range params[i*batchSize : min(len(params), (i+1)*batchSize)] {
+			b = appendBytes(b, 1, p)
+		}
+		b = appendVarint(b, 2, 1)
+		b = appendVarint(b, 3, uint64(count))
+		b = appendVarint(b, 4, uint64(i))
+		b = appendVarint(b, 5, uint64(id))
+		q := url.Values{"data": {base64.StdEncoding.EncodeToString(b)}}
+		uris = append(uris, migrationPrefix+"offline?"+q.Encode())
+	}
+	return uris
+}
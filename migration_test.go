@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/base64"
+	"fmt"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/thimc/totp/otp"
+)
+
+// googleExport is a single entry exported by Google Authenticator.
+const googleExport = "otpauth-migration://offline?data=CjEKCkhlbGxvId6tvu8SGEV4YW1wbGU6YWxpY2VAZ29vZ2xlLmNvbRoHRXhhbXBsZSABKAEwAhABGAEgACjr4JP9Aw%3D%3D"
+
+// testMigration returns a migration URI holding the OtpParameters
+// messages params as the batch index of size batches of export id.
+func testMigration(size, index, id int, params ...[]byte) string {
+	var b []byte
+	for _, p := range params {
+		b = appendBytes(b, 1, p)
+	}
+	b = appendVarint(b, 2, 1)
+	b = appendVarint(b, 3, uint64(size))
+	b = appendVarint(b, 4, uint64(index))
+	b = appendVarint(b, 5, uint64(id))
+	return migrationURI(b)
+}
+
+// migrationURI returns a migration URI holding the payload b.
+func migrationURI(b []byte) string {
+	return migrationPrefix + "offline?" + url.Values{"data": {base64.StdEncoding.EncodeToString(b)}}.Encode()
+}
+
+// testParameters returns an OtpParameters message of the entry name
+// using the algorithm, digits and type given, leaving out those that
+// are 0.
+func testParameters(name string, algorithm, digits, kind uint64) []byte {
+	var b []byte
+	b = appendBytes(b, 1, []byte(seed))
+	b = appendBytes(b, 2, []byte(name))
+	if algorithm != 0 {
+		b = appendVarint(b, 4, algorithm)
+	}
+	if digits != 0 {
+		b = appendVarint(b, 5, digits)
+	}
+	if kind != 0 {
+		b = appendVarint(b, 6, kind)
+	}
+	return b
+}
+
+func TestParseMigration(t *testing.T) {
+	m, err := parseMigration(googleExport)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.size != 1 || m.index != 0 || m.id != 1067774059 {
+		t.Errorf("batch %d of %d of export %d, want 0 of 1 of 1067774059", m.index, m.size, m.id)
+	}
+	if len(m.providers) != 1 {
+		t.Fatalf("got %d entries, want 1", len(m.providers))
+	}
+	p := m.providers[0]
+	if p.name != "Example:alice@google.com" || p.issuer != "Example" || p.secret != "JBSWY3DPEHPK3PXP" ||
+		string(p.key) != "Hello!\xde\xad\xbe\xef" || p.hotp {
+		t.Errorf("got %q issued by %q with secret %s, hotp %t", p.name, p.issuer, p.secret, p.hotp)
+	}
+	if c := p.config; c.Algorithm != otp.SHA1 || c.Digits != 6 || c.Period != otp.DefaultPeriod {
+		t.Errorf("got %s, %d digits, period %s", c.Algorithm, c.Digits, c.Period)
+	}
+
+	// Plus signs that weren't escaped are read as spaces. The name is
+	// chosen so that the data holds one.
+	unescaped := strings.ReplaceAll(testMigration(1, 0, 1, testParameters("~", 0, 0, 0)), "%2B", "+")
+	if !strings.Contains(unescaped, "+") {
+		t.Fatal("the test payload holds no plus sign")
+	}
+	if m, err := parseMigration(unescaped); err != nil || len(m.providers) != 1 {
+		t.Errorf("unescaped plus signs: %v", err)
+	}
+}
+
+func TestParseMigrationUnsupported(t *testing.T) {
+	tests := []struct {
+		name                    string
+		algorithm, digits, kind uint64
+	}{
+		{"md5", 4, 0, 0},
+		{"unknown algorithm", 9, 0, 0},
+		{"seven digits", 0, 3, 0},
+		{"unknown type", 0, 0, 3},
+	}
+	for _, tt := range tests {
+		m, err := parseMigration(testMigration(1, 0, 1,
+			testParameters(tt.name, tt.algorithm, tt.digits, tt.kind),
+			testParameters("ok", 0, 0, 0)))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(m.providers) != 1 || m.providers[0].name != "ok" {
+			t.Errorf("%s: got %d entries, want only the supported one", tt.name, len(m.providers))
+		}
+	}
+}
+
+func TestParseMigrationMalformed(t *testing.T) {
+	tests := []struct {
+		name string
+		uri  string
+		err  string
+	}{
+		{"scheme", "otpauth://offline?data=", "not a migration URI"},
+		{"host", "otpauth-migration://online?data=", "not a migration URI"},
+		{"base64", "otpauth-migration://offline?data=%21%21", "invalid base64 secret"},
+		{"truncated key", migrationURI([]byte{0x80}), "malformed field"},
+		{"truncated varint", migrationURI([]byte{0x18, 0x80}), "malformed varint"},
+		{"malformed length", migrationURI([]byte{0x0a, 0x80}), "malformed length"},
+		{"length past the end", migrationURI([]byte{0x0a, 0x05, 'a'}), "malformed length"},
+		{"truncated fixed64", migrationURI([]byte{0x09, 1, 2, 3}), "truncated message"},
+		{"truncated fixed32", migrationURI([]byte{0x0d, 1}), "truncated message"},
+		{"wire type", migrationURI([]byte{0x0b}), "unsupported wire type 3"},
+		{"truncated entry", migrationURI(appendBytes(nil, 1, []byte{0x0a, 0x10, 'a'})), "malformed length"},
+		{"missing secret", migrationURI(appendBytes(nil, 1, appendBytes(nil, 2, []byte("x")))), `"x": missing secret`},
+	}
+	for _, tt := range tests {
+		if _, err := parseMigration(tt.uri); err == nil || !strings.Contains(err.Error(), tt.err) {
+			t.Errorf("%s: parseMigration = %v, want %q", tt.name, err, tt.err)
+		}
+	}
+	// Fixed size fields, here numbered 6 and 7, are skipped.
+	b := append([]byte{0x31, 1, 2, 3, 4, 5, 6, 7, 8, 0x3d, 1, 2, 3, 4}, appendBytes(nil, 1, testParameters("a", 0, 0, 0))...)
+	if m, err := parseMigration(migrationURI(b)); err != nil || len(m.providers) != 1 {
+		t.Errorf("fixed size fields: %v", err)
+	}
+}
+
+func TestReadMigrations(t *testing.T) {
+	var (
+		a = testParameters("a", 0, 0, 0)
+		b = testParameters("b", 0, 0, 0)
+		c = testParameters("c", 0, 0, 0)
+	)
+	tests := []struct {
+		name  string
+		uris  []string
+		names []string
+		err   string
+	}{
+		{"real export", []string{googleExport}, []string{"Example:alice@google.com"}, ""},
+		{"batches", []string{testMigration(2, 1, 7, c), testMigration(2, 0, 7, a, b)}, []string{"c", "a", "b"}, ""},
+		{"exports", []string{testMigration(1, 0, 7, a), testMigration(1, 0, 8, b)}, []string{"a", "b"}, ""},
+		{"missing batch", []string{testMigration(3, 0, 7, a), testMigration(3, 2, 7, c)}, nil, "only 2 of the 3 batches of export 7 were given"},
+		{"duplicate batch", []string{testMigration(2, 0, 7, a), testMigration(2, 0, 7, a)}, nil, "batch 1 of export 7 was given twice"},
+		{"malformed", []string{testMigration(1, 0, 7, a), migrationURI([]byte{0x80})}, nil, "malformed field"},
+	}
+	for _, tt := range tests {
+		ps, err := readMigrations(tt.uris)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%s: readMigrations = %v, want %q", tt.name, err, tt.err)
+			}
+			continue
+		}
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		var names []string
+		for _, p := range ps {
+			names = append(names, p.name)
+		}
+		if fmt.Sprint(names) != fmt.Sprint(tt.names) {
+			t.Errorf("%s: got %q, want %q", tt.name, names, tt.names)
+		}
+	}
+}
+
+func TestOtpParameters(t *testing.T) {
+	tests := []provider{
+		{name: "ACME:john", issuer: "ACME", config: otp.Config{Algorithm: otp.SHA256, Digits: 8, Period: otp.DefaultPeriod}},
+		{name: "plain", config: otp.Config{Algorithm: otp.SHA512, Digits: 6}},
+		{name: "Bank:counter", issuer: "Bank", hotp: true, counter: 42, config: otp.Config{Digits: 6, Period: time.Minute}},
+	}
+	for _, p := range tests {
+		p.key = []byte(seed)
+		b, err := otpParameters(&p)
+		if err != nil {
+			t.Errorf("%s: %v", p.name, err)
+			continue
+		}
+		got, err := parseOtpParameters(b)
+		if err != nil || got == nil {
+			t.Errorf("%s: parseOtpParameters = %v, %v", p.name, got, err)
+			continue
+		}
+		c := p.generator()
+		if got.name != p.name || got.issuer != p.issuer || string(got.key) != seed ||
+			got.hotp != p.hotp || got.counter != p.counter ||
+			got.config.Algorithm != c.Algorithm || got.config.Digits != c.Digits {
+			t.Errorf("%s: round trip gave %+v", p.name, got)
+		}
+	}
+
+	for _, p := range []provider{
+		{name: "seven", config: otp.Config{Digits: 7}},
+		{name: "minute", config: otp.Config{Digits: 6, Period: time.Minute}},
+		{name: "steam", encoder: "steam", config: otp.Config{Digits: 5}},
+	} {
+		p.key = []byte(seed)
+		if _, err := otpParameters(&p); err == nil {
+			t.Errorf("%s: otpParameters succeeded", p.name)
+		}
+	}
+}
+
+func TestMigrationURIs(t *testing.T) {
+	var entries []*provider
+	for i := 0; i < 2*batchSize+3; i++ {
+		entries = append(entries, &provider{name: fmt.Sprintf("entry%02d", i), key: []byte(seed)})
+	}
+	uris := migrationURIs(entries)
+	if len(uris) != 3 {
+		t.Fatalf("got %d URIs, want 3", len(uris))
+	}
+	ps, err := readMigrations(uris)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ps) != len(entries) {
+		t.Fatalf("got %d entries, want %d", len(ps), len(entries))
+	}
+	for i, p := range ps {
+		if p.name != entries[i].name || string(p.key) != seed {
+			t.Errorf("entry %d is %q, want %q", i, p.name, entries[i].name)
+		}
+	}
+	if _, err := readMigrations(uris[1:]); err == nil {
+		t.Error("readMigrations succeeded without the first batch")
+	}
+}
@@ -0,0 +1,117 @@
+package main
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// sortProviders orders the providers by the field named by. Entries
+// are kept in the order of the secrets file unless by is name, issuer
+// or recent.
+func sortProviders(by string) error {
+	var less func(a, b *provider) bool
+	switch by {
+	case "file":
+		return nil
+	case "name":
+		less = func(a, b *provider) bool {
+			return strings.ToLower(a.name) < strings.ToLower(b.name)
+		}
+	case "issuer":
+		// Entries without an issuer go last.
+		less = func(a, b *provider) bool {
+			if (a.issuer == "") != (b.issuer == "") {
+				return b.issuer == ""
+			}
+			if x, y := strings.ToLower(a.issuer), strings.ToLower(b.issuer); x != y {
+				return x < y
+			}
+			return strings.ToLower(a.name) < strings.ToLower(b.name)
+		}
+	case "recent":
+		used, err := readRecent()
+		if err != nil {
+			return err
+		}
+		less = func(a, b *provider) bool {
+			return used[a.name].After(used[b.name])
+		}
+	default:
+		return fmt.Errorf("unknown sort order %q", by)
+	}
+	sort.SliceStable(providers, func(i, j int) bool {
+		return less(providers[i], providers[j])
+	})
+	return nil
+}
+
+// recentFile returns the path of the file which records when the
+// entries were last used.
+func recentFile() (string, error) {
+	dir := os.Getenv("XDG_STATE_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".local", "state")
+	}
+	return filepath.Join(dir, "totp", "recent"), nil
+}
+
+// readRecent returns the time each entry was last used. The file
+// holds a Unix timestamp and a name separated by a tab per line.
+func readRecent() (map[string]time.Time, error) {
+	used := make(map[string]time.Time)
+	path, err := recentFile()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return used, nil
+	} else if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	s := bufio.NewScanner(f)
+	for s.Scan() {
+		ts, name, ok := strings.Cut(s.Text(), "\t")
+		if !ok {
+			continue
+		}
+		if n, err := strconv.ParseInt(ts, 10, 64); err == nil {
+			used[name] = time.Unix(n, 0)
+		}
+	}
+	return used, s.Err()
+}
+
+// touch records that the entry name was used now.
+func touch(name string) error {
+	used, err := readRecent()
+	if err != nil {
+		return err
+	}
+	used[name] = time.Now()
+	path, err := recentFile()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o700); err != nil {
+		return err
+	}
+	var b strings.Builder
+	for name, t := range used {
+		fmt.Fprintf(&b, "%d\t%s\n", t.Unix(), name)
+	}
+	return writeFile(path, []byte(b.String()))
+}
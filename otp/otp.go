@@ -0,0 +1,252 @@
+// Package otp implements the HMAC-based (HOTP) and time-based (TOTP)
+// one-time password algorithms as specified by RFC4226 and RFC6238.
+package otp
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/binary"
+	"fmt"
+	"hash"
+	"math"
+	"strings"
+	"time"
+)
+
+// Algorithm is the HMAC algorithm used to generate passwords.
+type Algorithm int
+
+// The algorithms allowed by RFC6238.
+const (
+	SHA1 Algorithm = iota
+	SHA256
+	SHA512
+)
+
+var algorithms = [...]struct {
+	name string
+	hash func() hash.Hash
+}{
+	SHA1:   {"SHA1", sha1.New},
+	SHA256: {"SHA256", sha256.New},
+	SHA512: {"SHA512", sha512.New},
+}
+
+// ParseAlgorithm returns the algorithm named s, ignoring case.
+func ParseAlgorithm(s string) (Algorithm, error) {
+	for a, v := range algorithms {
+		if strings.EqualFold(s, v.name) {
+			return Algorithm(a), nil
+		}
+	}
+	return SHA1, fmt.Errorf("unsupported algorithm %q", s)
+}
+
+func (a Algorithm) String() string {
+	if a < 0 || int(a) >= len(algorithms) {
+		return fmt.Sprintf("Algorithm(%d)", int(a))
+	}
+	return algorithms[a].name
+}
+
+// Hash returns the hash constructor of a. It panics if a is not one of
+// the algorithms defined above.
+func (a Algorithm) Hash() func() hash.Hash {
+	if a < 0 || int(a) >= len(algorithms) {
+		panic("otp: unknown algorithm " + a.String())
+	}
+	return algorithms[a].hash
+}
+
+// An Encoder renders the value v obtained by the dynamic truncation
+// of RFC4226 as a password of length digits.
+type Encoder interface {
+	Encode(v uint32, digits int) string
+}
+
+// EncoderFunc adapts an ordinary function to the Encoder interface.
+type EncoderFunc func(v uint32, digits int) string
+
+// Encode returns f(v, digits).
+func (f EncoderFunc) Encode(v uint32, digits int) string {
+	return f(v, digits)
+}
+
+var (
+	// Decimal renders passwords as decimal digits as specified by
+	// RFC4226.
+	Decimal Encoder = EncoderFunc(decimal)
+
+	// Steam renders passwords as used by Steam Guard, which are
+	// always 5 characters long.
+	Steam Encoder = EncoderFunc(steam)
+)
+
+func decimal(v uint32, digits int) string {
+	digits = min(max(digits, 1), MaxDigits)
+	return fmt.Sprintf("%0*d", digits, uint64(v)%uint64(math.Pow10(digits)))
+}
+
+const steamAlphabet = "23456789BCDFGHJKMNPQRTVWXY"
+
+func steam(v uint32, _ int) string {
+	var b [5]byte
+	for i := range b {
+		b[i] = steamAlphabet[v%uint32(len(steamAlphabet))]
+		v /= uint32(len(steamAlphabet))
+	}
+	return string(b[:])
+}
+
+// The parameters used when the corresponding Config field is unset.
+const (
+	DefaultDigits = 6
+	DefaultPeriod = 30 * time.Second
+)
+
+// MaxDigits is the length of the longest decimal password, as the
+// value obtained by the dynamic truncation has at most 10 digits.
+const MaxDigits = 10
+
+// Config holds the parameters of a one-time password generator.
+type Config struct {
+	Key       []byte
+	Digits    int              // length of the passwords, DefaultDigits if not positive, at most MaxDigits
+	Period    time.Duration    // time step, DefaultPeriod if less than a second
+	Algorithm Algorithm        // SHA1 if not one of the defined algorithms
+	T0        time.Time        // start of the first time step, the Unix epoch if zero
+	Clock     func() time.Time // source of the current time, time.Now if nil
+	Encoder   Encoder          // renders the passwords, Decimal if nil
+}
+
+func (c *Config) digits() int {
+	if c.Digits < 1 {
+		return DefaultDigits
+	}
+	return min(c.Digits, MaxDigits)
+}
+
+func (c *Config) period() int64 {
+	if p := int64(c.Period / time.Second); p > 0 {
+		return p
+	}
+	return int64(DefaultPeriod / time.Second)
+}
+
+func (c *Config) algorithm() Algorithm {
+	if c.Algorithm < 0 || int(c.Algorithm) >= len(algorithms) {
+		return SHA1
+	}
+	return c.Algorithm
+}
+
+func (c *Config) t0() int64 {
+	if c.T0.IsZero() {
+		return 0
+	}
+	return c.T0.Unix()
+}
+
+func (c *Config) encoder() Encoder {
+	if c.Encoder == nil {
+		return Decimal
+	}
+	return c.Encoder
+}
+
+func (c *Config) now() time.Time {
+	if c.Clock == nil {
+		return time.Now()
+	}
+	return c.Clock()
+}
+
+// EffectivePeriod returns the time step that is used, which is Period
+// in whole seconds or DefaultPeriod if it is shorter than a second.
+func (c *Config) EffectivePeriod() time.Duration {
+	return time.Duration(c.period()) * time.Second
+}
+
+// HOTP returns the password for the counter value n as specified by
+// RFC4226.
+func (c *Config) HOTP(n uint64) string {
+	var (
+		mac = hmac.New(c.algorithm().Hash(), c.Key)
+		buf = make([]byte, 8)
+	)
+	binary.BigEndian.PutUint64(buf, n)
+	mac.Write(buf)
+	var (
+		sum    = mac.Sum(nil)
+		offset = sum[len(sum)-1] & 0xF
+		v      = binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7FFFFFFF
+	)
+	return c.encoder().Encode(v, c.digits())
+}
+
+// Counter returns the time step that t belongs to. Times before T0
+// belong to the first time step.
+func (c *Config) Counter(t time.Time) uint64 {
+	d := t.Unix() - c.t0()
+	if d < 0 {
+		return 0
+	}
+	return uint64(d / c.period())
+}
+
+// TOTP returns the password that is valid at t as specified by
+// RFC6238.
+func (c *Config) TOTP(t time.Time) string {
+	return c.HOTP(c.Counter(t))
+}
+
+// Remaining returns the time left until the password that is valid
+// at t expires.
+func (c *Config) Remaining(t time.Time) time.Duration {
+	next := c.t0() + int64(c.Counter(t)+1)*c.period()
+	return time.Unix(next, 0).Sub(t)
+}
+
+// Now returns the password that is currently valid according to the
+// clock.
+func (c *Config) Now() string {
+	return c.TOTP(c.now())
+}
+
+// Validate reports whether code is a valid password at the current
+// time according to the clock. Passwords of up to skew time steps
+// before or after the current one are accepted to allow for clock
+// drift, the returned offset is the time step that matched.
+func (c *Config) Validate(code string, skew int) (offset int, ok bool) {
+	return c.ValidateAt(c.now(), code, skew)
+}
+
+// ValidateAt is like Validate but checks code against the time t.
+func (c *Config) ValidateAt(t time.Time, code string, skew int) (offset int, ok bool) {
+	n := c.Counter(t)
+	// Every time step in the window is compared, even after a match,
+	// so the time taken doesn't reveal which step matched.
+	for _, i := range window(skew) {
+		if i < 0 && uint64(-i) > n {
+			continue
+		}
+		match := subtle.ConstantTimeCompare([]byte(c.HOTP(n+uint64(i))), []byte(code)) == 1
+		if match && !ok {
+			offset, ok = i, true
+		}
+	}
+	return offset, ok
+}
+
+// window returns the time step offsets within skew ordered by their
+// distance to the current one, i.e. 0, -1, 1, -2, 2 and so forth.
+func window(skew int) []int {
+	w := []int{0}
+	for i := 1; i <= skew; i++ {
+		w = append(w, -i, i)
+	}
+	return w
+}
@@ -0,0 +1,176 @@
+package otp
+
+import (
+	"testing"
+	"time"
+)
+
+// The seeds of the test vectors of RFC6238 Appendix B, sized to match
+// the output of each hash.
+var seeds = map[Algorithm][]byte{
+	SHA1:   []byte("12345678901234567890"),
+	SHA256: []byte("12345678901234567890123456789012"),
+	SHA512: []byte("1234567890123456789012345678901234567890123456789012345678901234"),
+}
+
+func TestTOTP(t *testing.T) {
+	tests := []struct {
+		t    int64
+		want map[Algorithm]string
+	}{
+		{59, map[Algorithm]string{SHA1: "94287082", SHA256: "46119246", SHA512: "90693936"}},
+		{1111111109, map[Algorithm]string{SHA1: "07081804", SHA256: "68084774", SHA512: "25091201"}},
+		{1111111111, map[Algorithm]string{SHA1: "14050471", SHA256: "67062674", SHA512: "99943326"}},
+		{1234567890, map[Algorithm]string{SHA1: "89005924", SHA256: "91819424", SHA512: "93441116"}},
+		{2000000000, map[Algorithm]string{SHA1: "69279037", SHA256: "90698825", SHA512: "38618901"}},
+		{20000000000, map[Algorithm]string{SHA1: "65353130", SHA256: "77737706", SHA512: "47863826"}},
+	}
+	for _, tt := range tests {
+		for a, want := range tt.want {
+			c := Config{Key: seeds[a], Digits: 8, Algorithm: a}
+			if got := c.TOTP(time.Unix(tt.t, 0)); got != want {
+				t.Errorf("%s TOTP(%d) = %s, want %s", a, tt.t, got, want)
+			}
+		}
+	}
+}
+
+func TestParseAlgorithm(t *testing.T) {
+	tests := []struct {
+		s    string
+		want Algorithm
+	}{
+		{"SHA1", SHA1},
+		{"sha1", SHA1},
+		{"SHA256", SHA256},
+		{"Sha256", SHA256},
+		{"sha512", SHA512},
+	}
+	for _, tt := range tests {
+		got, err := ParseAlgorithm(tt.s)
+		if err != nil || got != tt.want {
+			t.Errorf("ParseAlgorithm(%q) = %v, %v, want %v", tt.s, got, err, tt.want)
+		}
+	}
+	for _, s := range []string{"", "MD5", "SHA-1", "sha384"} {
+		if _, err := ParseAlgorithm(s); err == nil {
+			t.Errorf("ParseAlgorithm(%q) succeeded", s)
+		}
+	}
+}
+
+func TestHOTP(t *testing.T) {
+	// RFC4226 Appendix D.
+	want := []string{"755224", "287082", "359152", "969429", "338314", "254676", "287922", "162583", "399871", "520489"}
+	c := Config{Key: seeds[SHA1]}
+	for n, w := range want {
+		if got := c.HOTP(uint64(n)); got != w {
+			t.Errorf("HOTP(%d) = %s, want %s", n, got, w)
+		}
+	}
+}
+
+func TestInvalidConfig(t *testing.T) {
+	tests := []struct {
+		c    Config
+		want string
+	}{
+		{Config{Digits: -3}, "755224"},
+		{Config{Digits: 20}, "1284755224"},
+		{Config{Algorithm: Algorithm(7)}, "755224"},
+		{Config{Algorithm: -1}, "755224"},
+	}
+	for _, tt := range tests {
+		tt.c.Key = seeds[SHA1]
+		if got := tt.c.HOTP(0); got != tt.want {
+			t.Errorf("%+v: HOTP(0) = %s, want %s", tt.c, got, tt.want)
+		}
+	}
+	if got := Decimal.Encode(1284755224, -1); got != "4" {
+		t.Errorf("Decimal.Encode(1284755224, -1) = %s, want 4", got)
+	}
+}
+
+func TestCounter(t *testing.T) {
+	c := Config{Period: 30 * time.Second, T0: time.Unix(100, 0)}
+	tests := []struct {
+		t         int64
+		counter   uint64
+		remaining time.Duration
+	}{
+		{50, 0, 80 * time.Second},
+		{100, 0, 30 * time.Second},
+		{129, 0, time.Second},
+		{130, 1, 30 * time.Second},
+		{1000, 30, 30 * time.Second},
+		{1001, 30, 29 * time.Second},
+	}
+	for _, tt := range tests {
+		now := time.Unix(tt.t, 0)
+		if got := c.Counter(now); got != tt.counter {
+			t.Errorf("Counter(%d) = %d, want %d", tt.t, got, tt.counter)
+		}
+		if got := c.Remaining(now); got != tt.remaining {
+			t.Errorf("Remaining(%d) = %s, want %s", tt.t, got, tt.remaining)
+		}
+	}
+	if got := c.Remaining(time.Unix(129, 500*int64(time.Millisecond))); got != 500*time.Millisecond {
+		t.Errorf("Remaining(129.5) = %s, want 500ms", got)
+	}
+}
+
+func TestEffectivePeriod(t *testing.T) {
+	tests := []struct {
+		period, want time.Duration
+	}{
+		{0, DefaultPeriod},
+		{-time.Minute, DefaultPeriod},
+		{500 * time.Millisecond, DefaultPeriod},
+		{time.Second, time.Second},
+		{90*time.Second + 500*time.Millisecond, 90 * time.Second},
+	}
+	for _, tt := range tests {
+		c := Config{Period: tt.period}
+		if got := c.EffectivePeriod(); got != tt.want {
+			t.Errorf("EffectivePeriod() with Period %s = %s, want %s", tt.period, got, tt.want)
+		}
+	}
+}
+
+func TestValidateAt(t *testing.T) {
+	c := Config{Key: seeds[SHA1], Digits: 8}
+	now := time.Unix(1111111109, 0)
+	n := c.Counter(now)
+	tests := []struct {
+		code   string
+		skew   int
+		offset int
+		ok     bool
+	}{
+		{c.HOTP(n), 0, 0, true},
+		{c.HOTP(n - 1), 0, 0, false},
+		{c.HOTP(n - 1), 1, -1, true},
+		{c.HOTP(n + 1), 1, 1, true},
+		{c.HOTP(n - 2), 1, 0, false},
+		{c.HOTP(n + 2), 1, 0, false},
+		{c.HOTP(n - 2), 2, -2, true},
+		{c.HOTP(n + 2), 2, 2, true},
+		{"", 1, 0, false},
+		{c.HOTP(n)[:7], 1, 0, false},
+	}
+	for _, tt := range tests {
+		offset, ok := c.ValidateAt(now, tt.code, tt.skew)
+		if offset != tt.offset || ok != tt.ok {
+			t.Errorf("ValidateAt(%s, %d) = %d, %t, want %d, %t", tt.code, tt.skew, offset, ok, tt.offset, tt.ok)
+		}
+	}
+
+	// The window doesn't reach before the first time step.
+	now = time.Unix(10, 0)
+	if offset, ok := c.ValidateAt(now, c.HOTP(0), 3); !ok || offset != 0 {
+		t.Errorf("ValidateAt(first step) = %d, %t, want 0, true", offset, ok)
+	}
+	if offset, ok := c.ValidateAt(now, c.HOTP(3), 3); !ok || offset != 3 {
+		t.Errorf("ValidateAt(first step + 3) = %d, %t, want 3, true", offset, ok)
+	}
+}
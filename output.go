@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"time"
+)
+
+// status is the state of a time-based entry at a given time.
+type status struct {
+	Name      string `json:"name"`
+	Issuer    string `json:"issuer"`
+	Code      string `json:"code"`
+	Period    int    `json:"period"`
+	Remaining int    `json:"remaining"`
+	Next      string `json:"next"`
+}
+
+// statuses returns the state of every time-based entry at now.
+func statuses(now time.Time) []status {
+	var s []status
+	for _, p := range providers {
+		if p.hotp {
+			continue
+		}
+		var (
+			c = p.generator()
+			n = c.Counter(now)
+		)
+		s = append(s, status{
+			Name:      p.name,
+			Issuer:    p.issuer,
+			Code:      c.HOTP(n),
+			Period:    int(c.EffectivePeriod() / time.Second),
+			Remaining: int(math.Ceil(c.Remaining(now).Seconds())),
+			Next:      c.HOTP(n + 1),
+		})
+	}
+	return s
+}
+
+// printText writes the passwords at now and the time left until they
+// expire, preceded by a header.
+func printText(w io.Writer, now time.Time) {
+	s := statuses(now)
+	fmt.Fprintf(w, "%s - Next in %s\n", now.Format(*datefmt), time.Duration(math.Ceil(refresh(now).Seconds()))*time.Second)
+	for _, s := range s {
+		fmt.Fprintf(w, "%-25s %s (%ds)\n", s.Name, s.Code, s.Remaining)
+	}
+}
+
+// refresh returns the time left from now until the first password of
+// the time-based entries expires.
+func refresh(now time.Time) time.Duration {
+	var d time.Duration
+	for _, p := range providers {
+		if p.hotp {
+			continue
+		}
+		if r := p.generator().Remaining(now); d == 0 || r < d {
+			d = r
+		}
+	}
+	return d
+}
+
+// printJSON writes the state of the entries at now as a JSON array on
+// a single line.
+func printJSON(w io.Writer, now time.Time) error {
+	s := statuses(now)
+	if s == nil {
+		s = []status{}
+	}
+	return json.NewEncoder(w).Encode(s)
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// storeDir returns the directory of the password store.
+func storeDir() (string, error) {
+	if dir := os.Getenv("PASSWORD_STORE_DIR"); dir != "" {
+		return dir, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".password-store"), nil
+}
+
+// readStore reads the providers from the entries of the password
+// store holding an otpauth:// URI or a totp: field, like the ones
+// created by pass-otp(1). Entries are named after their path in the
+// store.
+func readStore(def provider) error {
+	dir, err := storeDir()
+	if err != nil {
+		return err
+	}
+	err = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() && path != dir && strings.HasPrefix(d.Name(), ".") {
+			return filepath.SkipDir
+		}
+		if d.IsDir() || filepath.Ext(path) != ".gpg" {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(strings.TrimSuffix(rel, ".gpg"))
+		data, err := decryptEntry(path)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s, ignoring\n", name, err)
+			return nil
+		}
+		p, ok, err := storeEntry(data, def)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "%s: %s, ignoring\n", name, err)
+		} else if ok {
+			p.name = name
+			add(p)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if len(providers) < 1 {
+		return fmt.Errorf("no entries with an otpauth:// URI or totp: field in %s", dir)
+	}
+	return nil
+}
+
+// decryptEntry decrypts the password store entry at path, natively if
+// a keyring is given by -k and using gpg(1) like pass does otherwise.
+func decryptEntry(path string) ([]byte, error) {
+	if *keyring != "" {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		return decryptPGP(data)
+	}
+	args := strings.Fields(os.Getenv("PASSWORD_STORE_GPG_OPTS"))
+	args = append(args, "--quiet", "--yes", "--compress-algo=none", "--no-encrypt-to", "-d", path)
+	var stderr bytes.Buffer
+	cmd := exec.Command("gpg", args...)
+	cmd.Stderr = &stderr
+	out, err := cmd.Output()
+	if err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return nil, fmt.Errorf("gpg: %s", msg)
+		}
+		return nil, err
+	}
+	return out, nil
+}
+
+// storeEntry returns the provider described by the decrypted entry
+// data. It reports false if the entry has neither an otpauth:// URI
+// nor a totp: field holding a URI or a secret.
+func storeEntry(data []byte, def provider) (provider, bool, error) {
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if strings.HasPrefix(line, "otpauth://") {
+			p, err := parseURI(line, def)
+			if err == nil {
+				err = p.decode()
+			}
+			return p, err == nil, err
+		}
+		key, value, ok := strings.Cut(line, ":")
+		if !ok || !strings.EqualFold(strings.TrimSpace(key), "totp") {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		p := def
+		p.secret = value
+		var err error
+		if strings.HasPrefix(value, "otpauth://") {
+			p, err = parseURI(value, def)
+		}
+		if err == nil {
+			err = p.decode()
+		}
+		return p, err == nil, err
+	}
+	return def, false, nil
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	pgperrors "github.com/ProtonMail/go-crypto/openpgp/errors"
+)
+
+const armorHeader = "-----BEGIN PGP"
+
+// isPGP reports whether data is an OpenPGP encrypted message, either
+// ASCII armored or binary.
+func isPGP(data []byte) bool {
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armorHeader+" MESSAGE-----")) {
+		return true
+	}
+	if len(data) < 3 || data[0]&0x80 == 0 {
+		return false
+	}
+	// A binary message starts with a packet holding the session key,
+	// encrypted either to a public key (tag 1) or with a passphrase
+	// (tag 3).
+	if data[0]&0x40 == 0 {
+		tag := data[0] >> 2 & 0xF
+		return tag == 1 || tag == 3
+	}
+	// New format packet headers may also start a line of UTF-8 text,
+	// so the version following the length of the packet is checked
+	// as well.
+	if tag := data[0] & 0x3F; tag != 1 && tag != 3 {
+		return false
+	}
+	var version int
+	switch l := data[1]; {
+	case l < 192:
+		version = 2
+	case l < 224:
+		version = 3
+	case l == 255:
+		version = 6
+	default:
+		return false
+	}
+	return len(data) > version && data[version] >= 3 && data[version] <= 6
+}
+
+// keys holds the keyring once it has been read, so that its keys only
+// have to be decrypted once.
+var keys openpgp.EntityList
+
+// readKeyring reads the secret keys from the file given by -k, which
+// may be ASCII armored or binary.
+func readKeyring() (openpgp.EntityList, error) {
+	if *keyring == "" || keys != nil {
+		return keys, nil
+	}
+	data, err := os.ReadFile(*keyring)
+	if err != nil {
+		return nil, err
+	}
+	if bytes.HasPrefix(bytes.TrimSpace(data), []byte(armorHeader)) {
+		keys, err = openpgp.ReadArmoredKeyRing(bytes.NewReader(data))
+	} else {
+		keys, err = openpgp.ReadKeyRing(bytes.NewReader(data))
+	}
+	return keys, err
+}
+
+// decryptPGP decrypts the OpenPGP message data using the keyring
+// given by -k or a passphrase. The passphrase is asked for on the
+// terminal, up to three times.
+func decryptPGP(data []byte) ([]byte, error) {
+	armored := bytes.HasPrefix(bytes.TrimSpace(data), []byte(armorHeader))
+	ring, err := readKeyring()
+	if err != nil {
+		return nil, fmt.Errorf("keyring: %w", err)
+	}
+	var (
+		tries int
+		// guessed is set while the last passphrase given is being
+		// tried on the session key of the message.
+		guessed bool
+	)
+	prompt := func(candidates []openpgp.Key, symmetric bool) ([]byte, error) {
+		guessed = false
+		if tries++; tries > 3 {
+			return nil, fmt.Errorf("too many attempts")
+		}
+		msg := "Passphrase: "
+		if len(candidates) > 0 {
+			msg = fmt.Sprintf("Passphrase for key %s: ", candidates[0].PublicKey.KeyIdString())
+		}
+		passphrase, err := readPassphrase(msg)
+		if err != nil {
+			return nil, err
+		}
+		// Decrypting the candidate keys makes them available to
+		// ReadMessage, which calls prompt again if none of them
+		// could be decrypted.
+		for _, k := range candidates {
+			k.PrivateKey.Decrypt(passphrase)
+		}
+		guessed = symmetric
+		return passphrase, nil
+	}
+	for {
+		var r io.Reader = bytes.NewReader(data)
+		if armored {
+			block, err := armor.Decode(bytes.NewReader(bytes.TrimSpace(data)))
+			if err != nil {
+				return nil, err
+			}
+			r = block.Body
+		}
+		var plain []byte
+		md, err := openpgp.ReadMessage(r, ring, prompt, nil)
+		if err == nil {
+			plain, err = io.ReadAll(md.UnverifiedBody)
+		}
+		// A wrong passphrase occasionally yields a session key that
+		// seems valid, so that reading fails on the garbled message
+		// instead of asking again.
+		if err != nil && guessed {
+			continue
+		}
+		if errors.Is(err, pgperrors.ErrKeyIncorrect) {
+			if *keyring == "" {
+				return nil, fmt.Errorf("the file is encrypted to a public key, specify the secret keyring with -k")
+			}
+			return nil, fmt.Errorf("none of the keys in %s can decrypt the file", *keyring)
+		} else if err != nil {
+			return nil, err
+		}
+		// Signatures by unknown keys can't be checked and are ignored.
+		if md.IsSigned && md.SignedBy != nil && md.SignatureError != nil {
+			return nil, fmt.Errorf("bad signature: %w", md.SignatureError)
+		}
+		return plain, nil
+	}
+}
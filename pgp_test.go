@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/ProtonMail/go-crypto/openpgp"
+	"github.com/ProtonMail/go-crypto/openpgp/armor"
+	"github.com/ProtonMail/go-crypto/openpgp/packet"
+)
+
+const pgpSecrets = "github\tJBSWY3DPEHPK3PXP\n"
+
+// newTestEntity generates a key pair quickly, using Curve25519.
+func newTestEntity(t *testing.T, name string) *openpgp.Entity {
+	t.Helper()
+	e, err := openpgp.NewEntity(name, "", name+"@example.com", &packet.Config{Algorithm: packet.PubKeyAlgoEdDSA})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+// useKeyring writes the secret keys of e to a file given by -k.
+func useKeyring(t *testing.T, e *openpgp.Entity, passphrase []byte) {
+	t.Helper()
+	var buf bytes.Buffer
+	if passphrase != nil {
+		if err := e.EncryptPrivateKeys(passphrase, nil); err != nil {
+			t.Fatal(err)
+		}
+		if err := e.SerializePrivateWithoutSigning(&buf, nil); err != nil {
+			t.Fatal(err)
+		}
+	} else if err := e.SerializePrivate(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "keyring.gpg")
+	if err := os.WriteFile(path, buf.Bytes(), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	setKeyring(t, path)
+}
+
+// setKeyring sets -k to path for the duration of the test.
+func setKeyring(t *testing.T, path string) {
+	old := *keyring
+	*keyring, keys = path, nil
+	t.Cleanup(func() { *keyring, keys = old, nil })
+}
+
+// usePassphrases answers the passphrase prompts with the passphrases in
+// turn, failing the test if there are more or fewer prompts.
+func usePassphrases(t *testing.T, passphrases ...string) {
+	old := readPassphrase
+	readPassphrase = func(prompt string) ([]byte, error) {
+		if len(passphrases) == 0 {
+			t.Errorf("unexpected prompt %q", prompt)
+			return nil, fmt.Errorf("no passphrase")
+		}
+		p := passphrases[0]
+		passphrases = passphrases[1:]
+		return []byte(p), nil
+	}
+	t.Cleanup(func() {
+		readPassphrase = old
+		if len(passphrases) > 0 {
+			t.Errorf("%d passphrases were not asked for", len(passphrases))
+		}
+	})
+}
+
+// encryptTo encrypts pgpSecrets to e, or with passphrase if e is nil.
+func encryptTo(t *testing.T, e *openpgp.Entity, passphrase string, armored bool) []byte {
+	t.Helper()
+	var (
+		buf bytes.Buffer
+		dst io.WriteCloser = nopCloser{&buf}
+		w   io.WriteCloser
+		err error
+	)
+	if armored {
+		if dst, err = armor.Encode(&buf, "PGP MESSAGE", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if e != nil {
+		w, err = openpgp.Encrypt(dst, []*openpgp.Entity{e}, nil, nil, nil)
+	} else {
+		w, err = openpgp.SymmetricallyEncrypt(dst, []byte(passphrase), nil, nil)
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := io.WriteString(w, pgpSecrets); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := dst.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+type nopCloser struct{ io.Writer }
+
+func (nopCloser) Close() error { return nil }
+
+func TestDecryptPGP(t *testing.T) {
+	e := newTestEntity(t, "alice")
+	for _, armored := range []bool{false, true} {
+		t.Run(fmt.Sprintf("public key armored=%t", armored), func(t *testing.T) {
+			useKeyring(t, e, nil)
+			usePassphrases(t)
+			data := encryptTo(t, e, "", armored)
+			if !isPGP(data) {
+				t.Fatal("isPGP = false")
+			}
+			plain, err := decryptPGP(data)
+			if err != nil || string(plain) != pgpSecrets {
+				t.Fatalf("decryptPGP = %q, %v", plain, err)
+			}
+		})
+		t.Run(fmt.Sprintf("symmetric armored=%t", armored), func(t *testing.T) {
+			setKeyring(t, "")
+			usePassphrases(t, "wrong0", slipPassphrase, "hunter2")
+			data := symmetricMessage(t, armored)
+			if !isPGP(data) {
+				t.Fatal("isPGP = false")
+			}
+			plain, err := decryptPGP(data)
+			if err != nil || string(plain) != pgpSecrets {
+				t.Fatalf("decryptPGP = %q, %v", plain, err)
+			}
+		})
+	}
+}
+
+// slipPassphrase is a wrong passphrase of testdata/symmetric.gpg
+// that yields a session key passing the check of its cipher, so that
+// decrypting only fails once the message is parsed.
+const slipPassphrase = "wrong214"
+
+// symmetricMessage returns pgpSecrets encrypted with the passphrase
+// "hunter2".
+func symmetricMessage(t *testing.T, armored bool) []byte {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "symmetric.gpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !armored {
+		return data
+	}
+	var buf bytes.Buffer
+	w, err := armor.Encode(&buf, "PGP MESSAGE", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(data)
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestDecryptPGPTooManyAttempts(t *testing.T) {
+	setKeyring(t, "")
+	usePassphrases(t, slipPassphrase, "wrong0", slipPassphrase)
+	if _, err := decryptPGP(symmetricMessage(t, false)); err == nil || !strings.Contains(err.Error(), "too many attempts") {
+		t.Errorf("decryptPGP = %v, want too many attempts", err)
+	}
+}
+
+func TestDecryptPGPProtectedKey(t *testing.T) {
+	e := newTestEntity(t, "alice")
+	data := encryptTo(t, e, "", false)
+	useKeyring(t, e, []byte("secret"))
+	usePassphrases(t, "secret")
+	plain, err := decryptPGP(data)
+	if err != nil || string(plain) != pgpSecrets {
+		t.Fatalf("decryptPGP = %q, %v", plain, err)
+	}
+}
+
+func TestDecryptPGPWrongKey(t *testing.T) {
+	var (
+		alice = newTestEntity(t, "alice")
+		bob   = newTestEntity(t, "bob")
+		data  = encryptTo(t, bob, "", false)
+	)
+	usePassphrases(t)
+	setKeyring(t, "")
+	if _, err := decryptPGP(data); err == nil || !strings.Contains(err.Error(), "specify the secret keyring with -k") {
+		t.Errorf("without keyring: %v", err)
+	}
+	useKeyring(t, alice, nil)
+	if _, err := decryptPGP(data); err == nil || !strings.Contains(err.Error(), "none of the keys in") {
+		t.Errorf("with the wrong keyring: %v", err)
+	}
+}
+
+func TestIsPGP(t *testing.T) {
+	for _, s := range []string{
+		"",
+		pgpSecrets,
+		"otpauth://totp/ACME:john?secret=JBSWY3DPEHPK3PXP",
+		"é\tJBSWY3DPEHPK3PXP",
+		"éa\tJBSWY3DPEHPK3PXP",
+		"Äpfel\tJBSWY3DPEHPK3PXP",
+		"Über\tJBSWY3DPEHPK3PXP",
+		"Банк\tJBSWY3DPEHPK3PXP",
+		"日本\tJBSWY3DPEHPK3PXP",
+		"😀\tJBSWY3DPEHPK3PXP",
+		"-----BEGIN PGP PUBLIC KEY BLOCK-----",
+		vaultMagic,
+	} {
+		if isPGP([]byte(s)) {
+			t.Errorf("isPGP(%q) = true", s)
+		}
+	}
+}
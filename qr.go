@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"rsc.io/qr"
+)
+
+// quietZone is the width in modules of the light border that has to
+// surround a QR code.
+const quietZone = 4
+
+// showQR renders the key URI of the entry matching query as a QR code.
+// It is written to path as a PNG or SVG image depending on its
+// extension, or drawn on the standard output if path is empty.
+func showQR(query, path string) error {
+	p, err := lookup(query)
+	if err != nil {
+		return err
+	}
+	code, err := qr.Encode(p.uri(), qr.M)
+	if err != nil {
+		return err
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case "":
+		if path != "" {
+			return fmt.Errorf("%s: missing .png or .svg extension", path)
+		}
+		return drawQR(os.Stdout, code)
+	case ".png":
+		return writeFile(path, code.PNG())
+	case ".svg":
+		var buf bytes.Buffer
+		writeSVG(&buf, code)
+		return writeFile(path, buf.Bytes())
+	default:
+		return fmt.Errorf("%s: unsupported image format", path)
+	}
+}
+
+// light reports whether the module at x, y of code is light, including
+// the quiet zone.
+func light(code *qr.Code, x, y int) bool {
+	x, y = x-quietZone, y-quietZone
+	if x < 0 || y < 0 || x >= code.Size || y >= code.Size {
+		return true
+	}
+	return !code.Black(x, y)
+}
+
+// drawQR draws code to w using half blocks, so that every character
+// holds two modules on top of each other. The colors are set
+// explicitly as readers expect dark modules on a light background.
+func drawQR(w io.Writer, code *qr.Code) error {
+	var (
+		buf  bytes.Buffer
+		size = code.Size + 2*quietZone
+	)
+	for y := 0; y < size; y += 2 {
+		buf.WriteString("\x1b[40;97m")
+		for x := 0; x < size; x++ {
+			top, bottom := light(code, x, y), y+1 < size && light(code, x, y+1)
+			switch {
+			case top && bottom:
+				buf.WriteString("█")
+			case top:
+				buf.WriteString("▀")
+			case bottom:
+				buf.WriteString("▄")
+			default:
+				buf.WriteString(" ")
+			}
+		}
+		buf.WriteString("\x1b[0m\n")
+	}
+	_, err := w.Write(buf.Bytes())
+	return err
+}
+
+// writeSVG writes code to w as an SVG image with one unit per module.
+func writeSVG(w io.Writer, code *qr.Code) {
+	size := code.Size + 2*quietZone
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" viewBox="0 0 %d %d" shape-rendering="crispEdges">`+"\n", size, size)
+	fmt.Fprintf(w, `<rect width="%d" height="%d" fill="#fff"/>`+"\n", size, size)
+	fmt.Fprint(w, `<path fill="#000" d="`)
+	for y := 0; y < code.Size; y++ {
+		for x := 0; x < code.Size; x++ {
+			if code.Black(x, y) {
+				fmt.Fprintf(w, "M%d %dh1v1h-1z", x+quietZone, y+quietZone)
+			}
+		}
+	}
+	fmt.Fprint(w, "\"/>\n</svg>\n")
+}
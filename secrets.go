@@ -0,0 +1,464 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"cmp"
+	"encoding/base32"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/thimc/totp/otp"
+)
+
+// provider is a single entry of the secrets file.
+type provider struct {
+	name   string
+	secret string
+	issuer string
+	config otp.Config
+
+	// encoding is the encoding of secret, key the decoded secret.
+	encoding string
+	key      []byte
+
+	// encoder is the name of config.Encoder, empty for the default.
+	encoder string
+
+	// hotp marks counter-based entries, counter is the value used
+	// to generate the next password.
+	hotp    bool
+	counter uint64
+
+	// line is the (zero-based) line of the secrets file the entry
+	// was read from, replaces is set if it replaced an earlier entry
+	// with the same name.
+	line     int
+	replaces bool
+}
+
+// encoders maps the names accepted by the encoder parameter to the
+// password encoders.
+var encoders = map[string]otp.Encoder{
+	"decimal": otp.Decimal,
+	"steam":   otp.Steam,
+}
+
+// decodeSecret returns the key encoded by secret. Apart from raw
+// secrets, whitespace is ignored and padding is optional. Base32
+// secrets, the default, may also be lower-case and contain dashes;
+// base64 secrets may use either the standard or the URL alphabet.
+func decodeSecret(secret, encoding string) ([]byte, error) {
+	var (
+		key []byte
+		err error
+		s   = strings.Join(strings.Fields(secret), "")
+	)
+	switch encoding {
+	case "", "base32":
+		s = strings.ToUpper(strings.NewReplacer("-", "", "=", "").Replace(s))
+		key, err = base32.StdEncoding.WithPadding(base32.NoPadding).DecodeString(s)
+	case "hex":
+		key, err = hex.DecodeString(strings.ReplaceAll(s, ":", ""))
+	case "base64":
+		s = strings.TrimRight(s, "=")
+		if strings.ContainsAny(s, "-_") {
+			key, err = base64.RawURLEncoding.DecodeString(s)
+		} else {
+			key, err = base64.RawStdEncoding.DecodeString(s)
+		}
+	case "raw":
+		key = []byte(secret)
+	default:
+		return nil, fmt.Errorf("unsupported encoding %q", encoding)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s secret", cmp.Or(encoding, "base32"))
+	}
+	if len(key) == 0 {
+		return nil, fmt.Errorf("empty secret")
+	}
+	return key, nil
+}
+
+// encodeSecret returns key as an unpadded base32 secret, the encoding
+// of key URIs.
+func encodeSecret(key []byte) string {
+	return base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString(key)
+}
+
+// decode decodes the secret of p.
+func (p *provider) decode() error {
+	var err error
+	p.key, err = decodeSecret(p.secret, p.encoding)
+	return err
+}
+
+// generator returns the password generator of p.
+func (p *provider) generator() *otp.Config {
+	c := p.config
+	c.Key = p.key
+	return &c
+}
+
+// readOnly is the reason the secrets can't be written back, if any.
+var readOnly error
+
+// problem is an issue with a line of the secrets file. Skipped lines
+// didn't make it into the providers.
+type problem struct {
+	line    int
+	err     error
+	skipped bool
+}
+
+// problems holds the issues found while parsing the secrets file.
+var problems []problem
+
+// load reads the providers from the password store if -p is
+// specified, or else from the secrets file given by -f or the
+// standard input. Encrypted secrets files are decrypted first. The
+// problems of the secrets file are reported unless cmd checks them
+// itself. A secrets file without entries is an error unless cmd
+// creates or checks them, a missing one unless cmd creates them.
+func load(def provider, cmd command) error {
+	if *passStore {
+		readOnly = errors.New("entries of the password store can't be modified")
+		return readStore(def)
+	}
+	f := os.Stdin
+	if *secrets != "" {
+		var err error
+		f, err = os.Open(*secrets)
+		if cmd.create && errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return fmt.Errorf("open: %w", err)
+		}
+		defer f.Close()
+	}
+	var err error
+	if input, err = io.ReadAll(f); err != nil {
+		return fmt.Errorf("read: %w", err)
+	}
+	switch {
+	case isVault(input):
+		passphrase, err := readPassphrase("Passphrase: ")
+		if err != nil {
+			return fmt.Errorf("passphrase: %w", err)
+		}
+		if sealed, input, err = openVault(input, passphrase); err != nil {
+			return fmt.Errorf("decrypt: %w", err)
+		}
+	case isPGP(input):
+		if input, err = decryptPGP(input); err != nil {
+			return fmt.Errorf("openpgp: %w", err)
+		}
+		readOnly = errors.New("OpenPGP encrypted secrets files can't be modified")
+	}
+	if err := parse(bytes.NewReader(input), def); err != nil {
+		return fmt.Errorf("parse: %w", err)
+	}
+	if !cmd.check {
+		for _, pr := range problems {
+			if pr.skipped {
+				fmt.Fprintf(os.Stderr, "line %d: %s, ignoring\n", pr.line+1, pr.err)
+			} else {
+				fmt.Fprintf(os.Stderr, "line %d: %s\n", pr.line+1, pr.err)
+			}
+		}
+	}
+	if len(providers) < 1 && !cmd.create && !cmd.check {
+		return fmt.Errorf("parse: invalid data provided")
+	}
+	return nil
+}
+
+// parse reads the providers from r. Every line is either a tab
+// separated entry or an otpauth:// URI, def holds the parameters used
+// unless the entry overrides them. Invalid entries are skipped and
+// added to the problems along with entries whose name is taken by an
+// earlier one, which they replace.
+func parse(r io.Reader, def provider) error {
+	var (
+		s    = bufio.NewScanner(r)
+		seen = make(map[string]int)
+	)
+	for n := 0; s.Scan(); n++ {
+		def.line = n
+		p, err := parseLine(s.Text(), def)
+		if err != nil {
+			for _, err := range unjoin(err) {
+				problems = append(problems, problem{line: n, err: err, skipped: true})
+			}
+			continue
+		}
+		if first, ok := seen[p.name]; ok {
+			err := fmt.Errorf("duplicate name %q, replacing line %d", p.name, first+1)
+			problems = append(problems, problem{line: n, err: err})
+		}
+		seen[p.name] = n
+		add(p)
+	}
+	return s.Err()
+}
+
+// unjoin returns the errors that were combined by errors.Join into
+// err, or err itself.
+func unjoin(err error) []error {
+	j, ok := err.(interface{ Unwrap() []error })
+	if !ok {
+		return []error{err}
+	}
+	var errs []error
+	for _, err := range j.Unwrap() {
+		errs = append(errs, unjoin(err)...)
+	}
+	return errs
+}
+
+// parseLine parses a single line of the secrets file and decodes its
+// secret. All problems of a tab separated entry are reported, joined
+// into one error.
+func parseLine(line string, def provider) (provider, error) {
+	var p provider
+	if strings.HasPrefix(line, "otpauth://") {
+		var err error
+		if p, err = parseURI(line, def); err != nil {
+			return p, fmt.Errorf("invalid uri: %w", err)
+		}
+	} else {
+		parts := strings.Split(line, "\t")
+		if len(parts) < 2 {
+			return p, fmt.Errorf("expected a name and a secret separated by a tab")
+		}
+		p = def
+		p.name = parts[0]
+		p.secret = parts[1]
+		var errs []error
+		if p.name == "" {
+			errs = append(errs, fmt.Errorf("empty name"))
+		}
+		errs = append(errs, p.options(parts[2:]), p.decode())
+		return p, errors.Join(errs...)
+	}
+	return p, p.decode()
+}
+
+// add appends p to the providers, replacing any earlier entry with
+// the same name.
+func add(p provider) {
+	for i := range providers {
+		if providers[i].name == p.name {
+			p.replaces = true
+			providers[i] = &p
+			return
+		}
+	}
+	providers = append(providers, &p)
+}
+
+// options applies the optional key=value fields that follow the
+// secret. The errors of all invalid fields are joined.
+func (p *provider) options(fields []string) error {
+	var errs []error
+	for _, field := range fields {
+		key, value, ok := strings.Cut(field, "=")
+		if !ok {
+			errs = append(errs, fmt.Errorf("malformed field %q", field))
+			continue
+		}
+		errs = append(errs, p.set(key, value))
+	}
+	return errors.Join(errs...)
+}
+
+// set assigns value to the parameter key of p.
+func (p *provider) set(key, value string) error {
+	switch key {
+	case "algorithm":
+		a, err := otp.ParseAlgorithm(value)
+		if err != nil {
+			return err
+		}
+		p.config.Algorithm = a
+	case "digits":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > otp.MaxDigits {
+			return fmt.Errorf("invalid digits %q", value)
+		}
+		p.config.Digits = n
+	case "period":
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			return fmt.Errorf("invalid period %q", value)
+		}
+		p.config.Period = time.Duration(n) * time.Second
+	case "encoding":
+		switch value {
+		case "base32", "hex", "base64", "raw":
+			p.encoding = value
+		default:
+			return fmt.Errorf("unsupported encoding %q", value)
+		}
+	case "encoder":
+		e, ok := encoders[strings.ToLower(value)]
+		if !ok {
+			return fmt.Errorf("unsupported encoder %q", value)
+		}
+		p.config.Encoder = e
+		p.encoder = strings.ToLower(value)
+	case "counter":
+		n, err := strconv.ParseUint(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid counter %q", value)
+		}
+		p.hotp = true
+		p.counter = n
+	default:
+		return fmt.Errorf("unknown parameter %q", key)
+	}
+	return nil
+}
+
+// parseURI parses a key URI as used by most authenticator apps:
+//
+//	otpauth://totp/Issuer:account?secret=...&issuer=...&digits=...
+//
+// The name of the entry is made up of the issuer and the account.
+func parseURI(s string, def provider) (provider, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return def, err
+	}
+	var (
+		p     = def
+		q     = u.Query()
+		label = strings.TrimPrefix(u.Path, "/")
+	)
+	switch u.Host {
+	case "totp":
+	case "hotp":
+		p.hotp = true
+	default:
+		return def, fmt.Errorf("unsupported type %q", u.Host)
+	}
+	p.secret = q.Get("secret")
+	if p.secret == "" {
+		return def, fmt.Errorf("missing secret")
+	}
+	p.issuer = q.Get("issuer")
+	for _, key := range []string{"algorithm", "digits", "period", "counter", "encoder"} {
+		if q.Has(key) {
+			if err := p.set(key, q.Get(key)); err != nil {
+				return def, err
+			}
+		}
+	}
+	p.setLabel(label)
+	if p.name == "" {
+		return def, fmt.Errorf("empty name")
+	}
+	return p, nil
+}
+
+// setLabel names p after the account label of a key URI, which may be
+// prefixed by the issuer. The name is made up of the issuer and the
+// account.
+func (p *provider) setLabel(label string) {
+	if issuer, account, ok := strings.Cut(label, ":"); ok {
+		if p.issuer == "" {
+			p.issuer = issuer
+		}
+		label = strings.TrimSpace(account)
+	}
+	p.name = label
+	if p.issuer != "" {
+		p.name = p.issuer + ":" + label
+	}
+}
+
+// account returns the name of p without the issuer.
+func (p *provider) account() string {
+	if p.issuer == "" {
+		return p.name
+	}
+	return strings.TrimPrefix(p.name, p.issuer+":")
+}
+
+// uri returns the key URI of p, holding all of its parameters so that
+// it doesn't depend on the defaults.
+func (p *provider) uri() string {
+	var (
+		c     = p.generator()
+		kind  = "totp"
+		label = p.name
+		q     = url.Values{}
+	)
+	q.Set("secret", encodeSecret(p.key))
+	if p.issuer != "" {
+		q.Set("issuer", p.issuer)
+		label = p.issuer + ":" + p.account()
+	}
+	q.Set("algorithm", c.Algorithm.String())
+	q.Set("digits", strconv.Itoa(cmp.Or(c.Digits, otp.DefaultDigits)))
+	if p.hotp {
+		kind = "hotp"
+		q.Set("counter", strconv.FormatUint(p.counter, 10))
+	} else {
+		q.Set("period", strconv.Itoa(int(cmp.Or(c.Period, otp.DefaultPeriod)/time.Second)))
+	}
+	if p.encoder != "" && p.encoder != "decimal" {
+		q.Set("encoder", p.encoder)
+	}
+	u := url.URL{Scheme: "otpauth", Host: kind, Path: "/" + label, RawQuery: q.Encode()}
+	return u.String()
+}
+
+// writeFile atomically replaces the file at path with data by writing
+// it to a temporary file in the same directory which is then renamed.
+// The permissions of an existing file are kept, new files are only
+// accessible by the user.
+func writeFile(path string, data []byte) error {
+	mode := os.FileMode(0o600)
+	if target, err := filepath.EvalSymlinks(path); err == nil {
+		fi, err := os.Stat(target)
+		if err != nil {
+			return err
+		}
+		path, mode = target, fi.Mode().Perm()
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(mode); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,220 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"golang.org/x/term"
+)
+
+// screen is the state of the interactive interface.
+type screen struct {
+	filter   string
+	selected int
+	top      int // the first entry shown
+	message  string
+	width    int
+	height   int
+}
+
+// visible returns the time-based entries matching the filter.
+func (s *screen) visible() []*provider {
+	var v []*provider
+	q := strings.ToLower(s.filter)
+	for _, p := range providers {
+		if !p.hotp && fuzzy(strings.ToLower(p.name), q) {
+			v = append(v, p)
+		}
+	}
+	return v
+}
+
+// draw renders the screen at now to buf, overwriting the previous
+// contents in place.
+func (s *screen) draw(buf *bytes.Buffer, now time.Time) {
+	var (
+		v    = s.visible()
+		bar  = max(10, min(30, s.width-50))
+		rows = max(1, s.height-4)
+	)
+	if s.selected >= len(v) {
+		s.selected = max(0, len(v)-1)
+	}
+	// The list is scrolled so that the selected entry is shown.
+	s.top = max(0, min(s.top, len(v)-rows, s.selected))
+	if s.selected >= s.top+rows {
+		s.top = s.selected - rows + 1
+	}
+	buf.WriteString("\x1b[H")
+	fmt.Fprintf(buf, "filter: %s\x1b[K\r\n\x1b[K\r\n", s.filter)
+	for i := s.top; i < min(len(v), s.top+rows); i++ {
+		var (
+			p      = v[i]
+			c      = p.generator()
+			left   = c.Remaining(now)
+			filled = min(bar, int(float64(bar)*left.Seconds()/c.EffectivePeriod().Seconds()))
+			cursor = " "
+		)
+		if i == s.selected {
+			cursor = ">"
+		}
+		fmt.Fprintf(buf, "%s %-25s %-10s %s%s %2ds\x1b[K\r\n",
+			cursor, p.name, c.TOTP(now),
+			strings.Repeat("█", filled), strings.Repeat("░", bar-filled),
+			int(math.Ceil(left.Seconds())))
+	}
+	fmt.Fprintf(buf, "\x1b[J\x1b[%dH%s\x1b[K", s.height, s.message)
+	fmt.Fprintf(buf, "\x1b[1;%dH", len("filter: ")+utf8.RuneCountInString(s.filter)+1)
+}
+
+// escape returns the length of the escape sequence at the start of b,
+// which begins with ESC: a CSI sequence (ESC [ parameters final), an
+// SS3 sequence (ESC O x) or a key pressed along with Alt. A lone ESC
+// has a length of 1.
+func escape(b []byte) int {
+	if len(b) < 2 || b[1] == 0x1b {
+		return 1
+	}
+	switch b[1] {
+	case '[':
+		for i := 2; i < len(b); i++ {
+			if b[i] >= 0x40 && b[i] <= 0x7e {
+				return i + 1
+			}
+		}
+		return len(b)
+	case 'O':
+		return min(3, len(b))
+	}
+	_, n := utf8.DecodeRune(b[1:])
+	return 1 + n
+}
+
+// key handles the input b and reports whether the interface should
+// be closed. Escape sequences of keys that aren't used are ignored.
+func (s *screen) key(b []byte) (quit bool) {
+	for len(b) > 0 {
+		if b[0] == 0x1b {
+			n := escape(b)
+			switch string(b[:n]) {
+			case "\x1b":
+				if s.filter == "" {
+					return true
+				}
+				s.filter = ""
+			case "\x1b[A", "\x1bOA":
+				s.selected = max(0, s.selected-1)
+			case "\x1b[B", "\x1bOB":
+				s.selected++
+			}
+			b = b[n:]
+			continue
+		}
+		switch c := b[0]; c {
+		case 0x03, 0x04: // ^C, ^D
+			return true
+		case 0x10: // ^P
+			s.selected = max(0, s.selected-1)
+		case 0x0e: // ^N
+			s.selected++
+		case 0x15: // ^U
+			s.filter = ""
+		case 0x7f, 0x08:
+			_, n := utf8.DecodeLastRuneInString(s.filter)
+			s.filter = s.filter[:len(s.filter)-n]
+		case '\r', '\n':
+			s.copy()
+		default:
+			if c >= 0x20 {
+				r, n := utf8.DecodeRune(b)
+				s.filter += string(r)
+				s.selected = 0
+				b = b[n:]
+				continue
+			}
+		}
+		b = b[1:]
+	}
+	return false
+}
+
+// copy places the password of the selected entry in the clipboard.
+func (s *screen) copy() {
+	v := s.visible()
+	if s.selected >= len(v) {
+		return
+	}
+	p := v[s.selected]
+	if err := copyClear(p.generator().Now()); err != nil {
+		s.message = fmt.Sprintf("copy: %s", err)
+		return
+	}
+	if err := touch(p.name); err != nil {
+		s.message = fmt.Sprintf("recent: %s", err)
+		return
+	}
+	s.message = fmt.Sprintf("copied %s", p.name)
+}
+
+// tui runs the interactive interface on the terminal until it is
+// closed. The keyboard is read from /dev/tty so that the secrets may
+// still be read from the standard input.
+func tui() error {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer tty.Close()
+	fd := int(tty.Fd())
+	state, err := term.MakeRaw(fd)
+	if err != nil {
+		return err
+	}
+	defer term.Restore(fd, state)
+	fmt.Fprint(tty, "\x1b[?1049h")
+	defer fmt.Fprint(tty, "\x1b[?1049l")
+
+	keys := make(chan []byte)
+	go func() {
+		buf := make([]byte, 256)
+		for {
+			n, err := tty.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			keys <- bytes.Clone(buf[:n])
+		}
+	}()
+	var (
+		s   = &screen{message: "↑/↓ select, enter copies, esc clears the filter or quits"}
+		buf bytes.Buffer
+		t   = time.NewTicker(250 * time.Millisecond)
+	)
+	defer t.Stop()
+	for {
+		if s.width, s.height, err = term.GetSize(fd); err != nil {
+			return err
+		}
+		if s.width == 0 || s.height == 0 {
+			s.width, s.height = 80, 24
+		}
+		buf.Reset()
+		s.draw(&buf, time.Now())
+		if _, err := tty.Write(buf.Bytes()); err != nil {
+			return err
+		}
+		select {
+		case b, ok := <-keys:
+			if !ok || s.key(b) {
+				return nil
+			}
+		case <-t.C:
+		}
+	}
+}
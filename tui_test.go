@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestScreenKey(t *testing.T) {
+	tests := []struct {
+		name     string
+		filter   string
+		input    string
+		want     string
+		selected int
+		quit     bool
+	}{
+		{"lone escape quits", "", "\x1b", "", 0, true},
+		{"lone escape clears", "ab", "\x1b", "", 0, false},
+		{"arrows", "", "\x1b[B\x1b[B\x1bOA", "", 1, false},
+		{"ignored csi", "ab", "\x1b[C\x1b[D\x1b[H\x1b[3~\x1b[5~\x1b[1;5C", "ab", 0, false},
+		{"ignored ss3", "ab", "\x1bOP\x1bOH", "ab", 0, false},
+		{"alt key", "ab", "\x1bx", "ab", 0, false},
+		{"utf-8", "", "é€x", "é€x", 0, false},
+		{"backspace", "aé", "\x7f", "a", 0, false},
+		{"typing resets selection", "", "\x1b[Bg", "g", 0, false},
+	}
+	for _, tt := range tests {
+		s := &screen{filter: tt.filter}
+		quit := s.key([]byte(tt.input))
+		if s.filter != tt.want || s.selected != tt.selected || quit != tt.quit {
+			t.Errorf("%s: filter %q, selected %d, quit %t, want %q, %d, %t",
+				tt.name, s.filter, s.selected, quit, tt.want, tt.selected, tt.quit)
+		}
+	}
+}
+
+func TestScreenScroll(t *testing.T) {
+	old := providers
+	t.Cleanup(func() { providers = old })
+	providers = nil
+	for i := 0; i < 20; i++ {
+		providers = append(providers, &provider{name: fmt.Sprintf("entry%02d", i), key: []byte(seed)})
+	}
+	var (
+		s   = &screen{width: 80, height: 10}
+		buf bytes.Buffer
+		now = time.Unix(59, 0)
+	)
+	tests := []struct {
+		input    string
+		selected int
+		top      int
+	}{
+		{"", 0, 0},
+		{"\x0e\x0e\x0e\x0e\x0e", 5, 0},
+		{"\x0e", 6, 1},
+		{strings.Repeat("\x0e", 30), 19, 14},
+		{"\x10\x10\x10\x10\x10\x10", 13, 13},
+	}
+	for _, tt := range tests {
+		s.key([]byte(tt.input))
+		buf.Reset()
+		s.draw(&buf, now)
+		if s.selected != tt.selected || s.top != tt.top {
+			t.Errorf("%q: selected %d, top %d, want %d, %d", tt.input, s.selected, s.top, tt.selected, tt.top)
+		}
+		if want := fmt.Sprintf("> entry%02d", tt.selected); !strings.Contains(buf.String(), want) {
+			t.Errorf("%q: %q isn't shown", tt.input, want)
+		}
+	}
+}
@@ -0,0 +1,254 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+
+	"golang.org/x/crypto/argon2"
+	"golang.org/x/crypto/chacha20poly1305"
+	"golang.org/x/term"
+)
+
+// An encrypted secrets file consists of a header followed by the
+// secrets sealed with XChaCha20-Poly1305, using the header as
+// additional data. The key is derived from a passphrase with Argon2id
+// using the parameters stored in the header:
+//
+//	magic   [8]byte  "TOTPVLT1"
+//	time    uint32   Argon2id passes
+//	memory  uint32   Argon2id memory in KiB
+//	threads uint8    Argon2id parallelism
+//	salt    [16]byte
+//	nonce   [24]byte
+const vaultMagic = "TOTPVLT1"
+
+const (
+	saltSize   = 16
+	headerSize = len(vaultMagic) + 4 + 4 + 1 + saltSize + chacha20poly1305.NonceSizeX
+)
+
+// sealed is the vault the secrets were read from, nil if they were
+// read as plain text.
+var sealed *vault
+
+// vault holds the key of an encrypted secrets file along with the
+// parameters it was derived with.
+type vault struct {
+	time, memory uint32
+	threads      uint8
+	salt         []byte
+	key          []byte
+}
+
+// isVault reports whether data is an encrypted secrets file.
+func isVault(data []byte) bool {
+	return bytes.HasPrefix(data, []byte(vaultMagic))
+}
+
+// newVault derives a new key from passphrase using a random salt and
+// the parameters recommended by RFC9106.
+func newVault(passphrase []byte) (*vault, error) {
+	v := &vault{time: 3, memory: 64 * 1024, threads: 4, salt: make([]byte, saltSize)}
+	if _, err := rand.Read(v.salt); err != nil {
+		return nil, err
+	}
+	v.derive(passphrase)
+	return v, nil
+}
+
+func (v *vault) derive(passphrase []byte) {
+	v.key = argon2.IDKey(passphrase, v.salt, v.time, v.memory, v.threads, chacha20poly1305.KeySize)
+}
+
+// openVault decrypts the encrypted secrets file data using the key
+// derived from passphrase.
+func openVault(data, passphrase []byte) (*vault, []byte, error) {
+	if len(data) < headerSize || !isVault(data) {
+		return nil, nil, fmt.Errorf("not an encrypted secrets file")
+	}
+	b := data[len(vaultMagic):]
+	v := &vault{
+		time:    binary.BigEndian.Uint32(b[0:4]),
+		memory:  binary.BigEndian.Uint32(b[4:8]),
+		threads: b[8],
+		salt:    bytes.Clone(b[9 : 9+saltSize]),
+	}
+	// Bound the parameters so that a crafted file can't make the
+	// key derivation take forever or exhaust the memory.
+	if v.time < 1 || v.time > 100 || v.memory < 8 || v.memory > 1024*1024 || v.threads < 1 {
+		return nil, nil, fmt.Errorf("invalid key derivation parameters")
+	}
+	v.derive(passphrase)
+	plain, err := v.open(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, plain, nil
+}
+
+// open decrypts data, which must have been sealed with the key of v.
+func (v *vault) open(data []byte) ([]byte, error) {
+	if len(data) < headerSize || !isVault(data) {
+		return nil, fmt.Errorf("not an encrypted secrets file")
+	}
+	if !bytes.Equal(data[len(vaultMagic)+9:len(vaultMagic)+9+saltSize], v.salt) {
+		return nil, fmt.Errorf("the passphrase has been changed")
+	}
+	aead, err := chacha20poly1305.NewX(v.key)
+	if err != nil {
+		return nil, err
+	}
+	var (
+		header = data[:headerSize]
+		nonce  = header[headerSize-chacha20poly1305.NonceSizeX:]
+	)
+	plain, err := aead.Open(nil, nonce, data[headerSize:], header)
+	if err != nil {
+		return nil, fmt.Errorf("wrong passphrase or corrupted file")
+	}
+	return plain, nil
+}
+
+// seal encrypts plain using a random nonce.
+func (v *vault) seal(plain []byte) ([]byte, error) {
+	aead, err := chacha20poly1305.NewX(v.key)
+	if err != nil {
+		return nil, err
+	}
+	header := make([]byte, 0, headerSize)
+	header = append(header, vaultMagic...)
+	header = binary.BigEndian.AppendUint32(header, v.time)
+	header = binary.BigEndian.AppendUint32(header, v.memory)
+	header = append(header, v.threads)
+	header = append(header, v.salt...)
+	nonce := make([]byte, chacha20poly1305.NonceSizeX)
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, err
+	}
+	header = append(header, nonce...)
+	return aead.Seal(header, nonce, plain, header), nil
+}
+
+// readPassphrase prompts for a passphrase, it is replaced by the tests.
+var readPassphrase = ttyPassphrase
+
+// ttyPassphrase prompts for a passphrase on the terminal.
+func ttyPassphrase(prompt string) ([]byte, error) {
+	tty, err := os.OpenFile("/dev/tty", os.O_RDWR, 0)
+	if err != nil {
+		return nil, err
+	}
+	defer tty.Close()
+	fmt.Fprint(tty, prompt)
+	defer fmt.Fprintln(tty)
+	return term.ReadPassword(int(tty.Fd()))
+}
+
+// newPassphrase prompts for a new passphrase, which has to be entered
+// twice.
+func newPassphrase() ([]byte, error) {
+	p, err := readPassphrase("New passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if len(p) == 0 {
+		return nil, fmt.Errorf("empty passphrase")
+	}
+	again, err := readPassphrase("Repeat passphrase: ")
+	if err != nil {
+		return nil, err
+	}
+	if !bytes.Equal(p, again) {
+		return nil, fmt.Errorf("the passphrases do not match")
+	}
+	return p, nil
+}
+
+// readSecrets returns the contents of the secrets file at path,
+// decrypted with the key of the vault it was first read from.
+func readSecrets(path string) ([]byte, error) {
+	if readOnly != nil {
+		return nil, readOnly
+	}
+	data, err := os.ReadFile(path)
+	if err != nil || sealed == nil {
+		return data, err
+	}
+	return sealed.open(data)
+}
+
+// writeSecrets replaces the secrets file at path with data, encrypted
+// if it was read from a vault.
+func writeSecrets(path string, data []byte) error {
+	if readOnly != nil {
+		return readOnly
+	}
+	if sealed != nil {
+		var err error
+		if data, err = sealed.seal(data); err != nil {
+			return err
+		}
+	}
+	return writeFile(path, data)
+}
+
+// encrypt writes the secrets that were read to a new encrypted
+// secrets file at path.
+func encrypt(path string) error {
+	if _, err := os.Lstat(path); err == nil {
+		return fmt.Errorf("%s already exists", path)
+	} else if !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	passphrase, err := newPassphrase()
+	if err != nil {
+		return err
+	}
+	v, err := newVault(passphrase)
+	if err != nil {
+		return err
+	}
+	if len(input) == 0 {
+		return fmt.Errorf("there are no secrets to encrypt")
+	}
+	data, err := v.seal(input)
+	if err != nil {
+		return err
+	}
+	return writeFile(path, data)
+}
+
+// rekey encrypts the secrets file given by -f with a new passphrase,
+// provided it hasn't been changed since it was read.
+func rekey() error {
+	if sealed == nil || *secrets == "" {
+		return fmt.Errorf("-f is not an encrypted secrets file")
+	}
+	passphrase, err := newPassphrase()
+	if err != nil {
+		return err
+	}
+	v, err := newVault(passphrase)
+	if err != nil {
+		return err
+	}
+	// Changes made since the secrets were read, such as a counter
+	// that was advanced, would be lost otherwise.
+	if err := unchanged(*secrets); err != nil {
+		return err
+	}
+	data, err := v.seal(input)
+	if err != nil {
+		return err
+	}
+	if err := writeFile(*secrets, data); err != nil {
+		return err
+	}
+	sealed = v
+	return nil
+}
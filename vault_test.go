@@ -0,0 +1,203 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/thimc/totp/otp"
+)
+
+const vaultSecrets = "github\tJBSWY3DPEHPK3PXP\nbank\tGEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ\tcounter=3\n"
+
+// loadSecrets reads the secrets file at path given by -f, as done
+// before running a command, forgetting the secrets read before.
+func loadSecrets(t *testing.T, path string) error {
+	t.Helper()
+	old := *secrets
+	reset := func(path string) {
+		*secrets, input, sealed, readOnly = path, nil, nil, nil
+		providers, problems = nil, nil
+	}
+	reset(path)
+	t.Cleanup(func() { reset(old) })
+	return load(provider{}, command{})
+}
+
+// testVault returns a vault using cheap key derivation parameters.
+func testVault(t *testing.T, passphrase string) *vault {
+	t.Helper()
+	v := &vault{time: 1, memory: 8, threads: 1, salt: bytes.Repeat([]byte{7}, saltSize)}
+	v.derive([]byte(passphrase))
+	return v
+}
+
+func TestVaultHeader(t *testing.T) {
+	v := testVault(t, "hunter2")
+	data, err := v.seal([]byte(vaultSecrets))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !isVault(data) || len(data) <= headerSize {
+		t.Fatalf("sealed %d bytes without a header", len(data))
+	}
+	got, plain, err := openVault(data, []byte("hunter2"))
+	if err != nil || string(plain) != vaultSecrets {
+		t.Fatalf("openVault = %q, %v", plain, err)
+	}
+	if got.time != v.time || got.memory != v.memory || got.threads != v.threads ||
+		!bytes.Equal(got.salt, v.salt) || !bytes.Equal(got.key, v.key) {
+		t.Errorf("openVault read %+v, want %+v", got, v)
+	}
+	// Sealing again uses a new nonce.
+	again, err := v.seal([]byte(vaultSecrets))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Equal(again[:headerSize], data[:headerSize]) {
+		t.Error("the nonce was reused")
+	}
+}
+
+func TestOpenVaultErrors(t *testing.T) {
+	data, err := testVault(t, "hunter2").seal([]byte(vaultSecrets))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// params returns data with the key derivation parameters replaced.
+	params := func(time, memory uint32, threads uint8) []byte {
+		b := bytes.Clone(data)
+		binary.BigEndian.PutUint32(b[len(vaultMagic):], time)
+		binary.BigEndian.PutUint32(b[len(vaultMagic)+4:], memory)
+		b[len(vaultMagic)+8] = threads
+		return b
+	}
+	// flip returns data with the bits of the byte at i inverted.
+	flip := func(i int) []byte {
+		b := bytes.Clone(data)
+		b[i] ^= 0xff
+		return b
+	}
+	tests := []struct {
+		name       string
+		data       []byte
+		passphrase string
+		err        string
+	}{
+		{"wrong passphrase", data, "hunter3", "wrong passphrase or corrupted file"},
+		{"truncated header", data[:headerSize-1], "hunter2", "not an encrypted secrets file"},
+		{"plain text", []byte(vaultSecrets), "hunter2", "not an encrypted secrets file"},
+		{"no passes", params(0, 8, 1), "hunter2", "invalid key derivation parameters"},
+		{"too many passes", params(101, 8, 1), "hunter2", "invalid key derivation parameters"},
+		{"too little memory", params(1, 7, 1), "hunter2", "invalid key derivation parameters"},
+		{"too much memory", params(1, 1024*1024+1, 1), "hunter2", "invalid key derivation parameters"},
+		{"no threads", params(1, 8, 0), "hunter2", "invalid key derivation parameters"},
+		{"other parameters", params(2, 8, 1), "hunter2", "wrong passphrase or corrupted file"},
+		{"corrupted salt", flip(len(vaultMagic) + 9), "hunter2", "wrong passphrase or corrupted file"},
+		{"corrupted nonce", flip(headerSize - 1), "hunter2", "wrong passphrase or corrupted file"},
+		{"corrupted secrets", flip(headerSize), "hunter2", "wrong passphrase or corrupted file"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, _, err := openVault(tt.data, []byte(tt.passphrase)); err == nil || err.Error() != tt.err {
+				t.Errorf("openVault = %v, want %q", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestVault(t *testing.T) {
+	var (
+		dir   = t.TempDir()
+		plain = filepath.Join(dir, "secrets")
+		path  = filepath.Join(dir, "secrets.vault")
+	)
+	if err := os.WriteFile(plain, []byte(vaultSecrets), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := loadSecrets(t, plain); err != nil {
+		t.Fatal(err)
+	}
+	usePassphrases(t, "hunter2", "hunter2", "hunter2", "swordfish", "swordfish", "swordfish")
+	if err := encrypt(path); err != nil {
+		t.Fatalf("encrypt: %v", err)
+	}
+
+	if err := loadSecrets(t, path); err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if sealed == nil || string(input) != vaultSecrets {
+		t.Fatalf("load read %q", input)
+	}
+	p, err := lookup("bank")
+	if err != nil {
+		t.Fatal(err)
+	}
+	code, err := advance(p)
+	if err != nil {
+		t.Fatalf("advance: %v", err)
+	}
+	if want := (&otp.Config{Key: []byte(seed)}).HOTP(3); code != want {
+		t.Errorf("advance = %s, want %s", code, want)
+	}
+	advanced := strings.Replace(vaultSecrets, "counter=3", "counter=4", 1)
+	if _, plain, err := openVault(mustRead(t, path), []byte("hunter2")); err != nil || string(plain) != advanced {
+		t.Fatalf("after advancing the counter the file holds %q, %v", plain, err)
+	}
+
+	if err := rekey(); err != nil {
+		t.Fatalf("rekey: %v", err)
+	}
+	if _, _, err := openVault(mustRead(t, path), []byte("hunter2")); err == nil {
+		t.Error("the old passphrase still opens the file")
+	}
+	if err := loadSecrets(t, path); err != nil {
+		t.Fatalf("load after rekey: %v", err)
+	}
+	if string(input) != advanced {
+		t.Errorf("load after rekey read %q, want %q", input, advanced)
+	}
+}
+
+func TestRekeyChanged(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "secrets.vault")
+	v := testVault(t, "hunter2")
+	data, err := v.seal([]byte(vaultSecrets))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	usePassphrases(t, "hunter2", "swordfish", "swordfish")
+	if err := loadSecrets(t, path); err != nil {
+		t.Fatal(err)
+	}
+	// Another process advances a counter meanwhile.
+	changed := strings.Replace(vaultSecrets, "counter=3", "counter=4", 1)
+	if data, err = v.seal([]byte(changed)); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0o600); err != nil {
+		t.Fatal(err)
+	}
+	if err := rekey(); err == nil || !strings.Contains(err.Error(), "changed since it was read") {
+		t.Fatalf("rekey = %v, want the file to be reported as changed", err)
+	}
+	if _, plain, err := openVault(mustRead(t, path), []byte("hunter2")); err != nil || string(plain) != changed {
+		t.Errorf("rekey overwrote the file: %q, %v", plain, err)
+	}
+}
+
+// mustRead returns the contents of the file at path.
+func mustRead(t *testing.T, path string) []byte {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
@@ -0,0 +1,21 @@
+package main
+
+import "fmt"
+
+// verify checks code against the current password of the entry
+// matching query and reports the time step that matched.
+func verify(query, code string) error {
+	p, err := lookup(query)
+	if err != nil {
+		return err
+	}
+	if p.hotp {
+		return fmt.Errorf("%q is counter-based", p.name)
+	}
+	offset, ok := p.generator().Validate(code, *skew)
+	if !ok {
+		return fmt.Errorf("code does not match")
+	}
+	fmt.Printf("match at time step %+d\n", offset)
+	return nil
+}